@@ -15,10 +15,11 @@
 package backend
 
 import (
-	"bytes"
 	"context"
 	"crypto/ecdsa"
 	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"math/big"
 	"regexp"
@@ -30,13 +31,10 @@ import (
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
-	"golang.org/x/crypto/sha3"
+	"github.com/holiman/uint256"
 
 	"github.com/btcsuite/btcd/btcec/v2"
-	"github.com/btcsuite/btcd/btcutil"
-	"github.com/btcsuite/btcd/chaincfg"
-
-	"github.com/okx/go-wallet-sdk/coins/tron"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
 )
 
 const (
@@ -46,9 +44,18 @@ const (
 
 // Account is an Ethereum account
 type Account struct {
-	Address    string `json:"address"`
-	PrivateKey string `json:"private_key"`
-	PublicKey  string `json:"public_key"`
+	Address     string `json:"address"`
+	PrivateKey  string `json:"private_key"`
+	PublicKey   string `json:"public_key"`
+	AddressType string `json:"address_type,omitempty"`
+	// TaprootInternalKey is the x-only BIP-86 internal key of P2TR accounts
+	TaprootInternalKey string `json:"taproot_internal_key,omitempty"`
+	// RedeemScript is the hex encoded P2SH redeem script of P2SH-P2WPKH accounts
+	RedeemScript string `json:"redeem_script,omitempty"`
+	// Wallet is the HD wallet the key of derived accounts comes from, PrivateKey is empty for them
+	Wallet string `json:"wallet,omitempty"`
+	// DerivationPath is the BIP-32 path of the key of derived accounts
+	DerivationPath string `json:"derivation_path,omitempty"`
 }
 
 func paths(b *backend) []*framework.Path {
@@ -58,6 +65,21 @@ func paths(b *backend) []*framework.Path {
 		pathSign(b),
 		pathExport(b),
 		pathSignRaw(b),
+		pathSignAuthorization(b),
+		pathSignMessage(b),
+		pathSignTypedData(b),
+		pathSignPsbt(b),
+		pathSignInput(b),
+		pathSignTron(b),
+		pathSignCosmos(b),
+		pathSignXrpl(b),
+		pathSignBatch(b),
+		pathVerify(b),
+		pathRecover(b),
+		pathListWallets(b),
+		pathWallet(b),
+		pathWalletDerive(b),
+		pathWalletXpub(b),
 	}
 }
 
@@ -101,55 +123,19 @@ func (b *backend) createAccount(ctx context.Context, req *logical.Request, data
 	publicKey := privateKey.Public()
 	publicKeyECDSA, _ := publicKey.(*ecdsa.PublicKey)
 	publicKeyBytes := crypto.FromECDSAPub(publicKeyECDSA)
-	publicKeyString := hexutil.Encode(publicKeyBytes)[4:]
-
-	address := ""
-	addrTypeInput := data.Get("addressType").(string)
-	switch addrTypeInput {
-	case "P2PKH":
-		pubKeyHash := btcutil.Hash160(publicKeyBytes)
-
-		params := &chaincfg.MainNetParams
-		var addr btcutil.Address
-		addr, err = btcutil.NewAddressPubKeyHash(
-			pubKeyHash, params,
-		)
-		if err != nil {
-			return nil, err
-		}
-		address = addr.EncodeAddress()
-	case "P2PKH-Testnet":
-		pubKeyHash := btcutil.Hash160(publicKeyBytes)
-
-		params := &chaincfg.TestNet3Params
-		var addr btcutil.Address
-		addr, err = btcutil.NewAddressPubKeyHash(
-			pubKeyHash, params,
-		)
-		if err != nil {
-			return nil, err
-		}
-		address = addr.EncodeAddress()
-	case "TRON":
-		pub, err := btcec.ParsePubKey(publicKeyBytes)
-		if err != nil {
-			return nil, err
-		}
-		address = tron.GetAddress(pub)
 
-	default: //ETH address is generated by default
-		hash := sha3.NewLegacyKeccak256()
-		hash.Write(publicKeyBytes[1:])
-		address = hexutil.Encode(hash.Sum(nil)[12:])
+	pub, err := btcec.ParsePubKey(publicKeyBytes)
+	if err != nil {
+		return nil, err
 	}
-
-	accountPath := fmt.Sprintf("accounts/%s", address)
-
-	accountJSON := &Account{
-		Address:    address,
-		PrivateKey: privateKeyString,
-		PublicKey:  publicKeyString,
+	accountJSON, err := newAccount(pub, data.Get("addressType").(string), data.Get("hrp").(string), false)
+	if err != nil {
+		b.Logger().Error("Failed to derive the account address", "error", err)
+		return nil, err
 	}
+	accountJSON.PrivateKey = privateKeyString
+
+	accountPath := fmt.Sprintf("accounts/%s", accountJSON.Address)
 
 	entry, _ := logical.StorageEntryJSON(accountPath, accountJSON)
 	err = req.Storage.Put(ctx, entry)
@@ -158,11 +144,56 @@ func (b *backend) createAccount(ctx context.Context, req *logical.Request, data
 		return nil, err
 	}
 
-	return &logical.Response{
+	resp := &logical.Response{
 		Data: map[string]interface{}{
 			"address": accountJSON.Address,
 		},
-	}, nil
+	}
+	forms, _ := accountAddressForms(accountJSON)
+	for k, v := range forms {
+		resp.Data[k] = v
+	}
+	return resp, nil
+}
+
+// newAccount returns the account of the public key for the address type, without its private key.
+// The hrp is the human readable part of COSMOS addresses, empty for the default. P2PKH addresses
+// of derived accounts hash the compressed key, like the other BIP-32 wallets do.
+func newAccount(pub *btcec.PublicKey, addressType string, hrp string, derived bool) (*Account, error) {
+	var address string
+	var err error
+	switch {
+	case addressType == AddressTypeCOSMOS && hrp != "":
+		address, err = cosmosAddress(hrp, pub)
+	case hrp != "":
+		return nil, fmt.Errorf("'hrp' is only supported by the %s address type", AddressTypeCOSMOS)
+	default:
+		address, err = deriveAddress(addressType, pub, derived)
+	}
+	if err != nil {
+		return nil, err
+	}
+	account := &Account{
+		Address:     address,
+		PublicKey:   hexutil.Encode(pub.SerializeUncompressed())[4:],
+		AddressType: addressType,
+	}
+	if isTaprootAddressType(addressType) {
+		account.TaprootInternalKey = hexutil.Encode(schnorr.SerializePubKey(pub))[2:]
+	}
+	if script := redeemScript(addressType, pub); script != nil {
+		account.RedeemScript = hexutil.Encode(script)[2:]
+	}
+	return account, nil
+}
+
+// parseAccountPublicKey parses the stored public key of the account
+func parseAccountPublicKey(account *Account) (*btcec.PublicKey, error) {
+	pubKeyBytes, err := hexutil.Decode("0x04" + account.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return btcec.ParsePubKey(pubKeyBytes)
 }
 
 func (b *backend) readAccount(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
@@ -176,12 +207,38 @@ func (b *backend) readAccount(ctx context.Context, req *logical.Request, data *f
 		return nil, fmt.Errorf("Account does not exist")
 	}
 
-	return &logical.Response{
+	resp := &logical.Response{
 		Data: map[string]interface{}{
 			"address":   account.Address,
 			"publicKey": account.PublicKey,
 		},
-	}, nil
+	}
+	if len(account.PublicKey) == 128 {
+		// the BIP-340 x-only public key is the X coordinate of the uncompressed key
+		resp.Data["xOnlyPublicKey"] = account.PublicKey[:64]
+	}
+	if account.AddressType != "" {
+		resp.Data["addressType"] = account.AddressType
+	}
+	if account.TaprootInternalKey != "" {
+		resp.Data["taprootInternalKey"] = account.TaprootInternalKey
+	}
+	if account.RedeemScript != "" {
+		resp.Data["redeemScript"] = account.RedeemScript
+	}
+	if account.Wallet != "" {
+		resp.Data["wallet"] = account.Wallet
+		resp.Data["derivationPath"] = account.DerivationPath
+	}
+	forms, err := accountAddressForms(account)
+	if err != nil {
+		b.Logger().Error("Failed to parse the account public key", "error", err)
+		return nil, err
+	}
+	for k, v := range forms {
+		resp.Data[k] = v
+	}
+	return resp, nil
 }
 
 func (b *backend) exportAccount(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
@@ -195,8 +252,20 @@ func (b *backend) exportAccount(ctx context.Context, req *logical.Request, data
 		return nil, fmt.Errorf("Account does not exist")
 	}
 
+	privateKeyHex := []byte(account.PrivateKey)
+	if account.Wallet != "" {
+		// derived accounts export the key derived from the wallet seed
+		privateKey, err := b.retrievePrivateKey(ctx, req, account)
+		if err != nil {
+			return nil, err
+		}
+		defer ZeroKey(privateKey)
+		privateKeyHex = []byte(hex.EncodeToString(crypto.FromECDSA(privateKey)))
+		defer zeroBytes(privateKeyHex)
+	}
+
 	encryptedData := b.rsaProvider.EncryptWithPublicKey(
-		[]byte(account.PrivateKey),
+		privateKeyHex,
 		[]byte(data.Get("rsaPublicKey").(string)))
 
 	return &logical.Response{
@@ -221,14 +290,19 @@ func (b *backend) deleteAccount(ctx context.Context, req *logical.Request, data
 		b.Logger().Error("Failed to delete the account from storage", "address", address, "error", err)
 		return nil, err
 	}
+	if account.Wallet != "" {
+		return nil, b.removeWalletAccount(ctx, req, account.Wallet, account.Address)
+	}
 	return nil, nil
 }
 
+// ethAddressRegex matches Ethereum addresses, with or without the 0x prefix
+var ethAddressRegex = regexp.MustCompile("^(0x)?[0-9a-fA-F]{40}$")
+
 func (b *backend) retrieveAccount(ctx context.Context, req *logical.Request, address string) (*Account, error) {
 	var path string
-	matched, err := regexp.MatchString("^(0x)?[0-9a-fA-F]{40}$", address)
-	if !matched || err != nil {
-		b.Logger().Error("Failed to retrieve the account, malformatted account address", "address", address, "error", err)
+	if !ethAddressRegex.MatchString(address) {
+		b.Logger().Error("Failed to retrieve the account, malformatted account address", "address", address)
 		return nil, fmt.Errorf("Failed to retrieve the account, malformatted account address")
 	} else {
 		// make sure the address has the "0x prefix"
@@ -271,6 +345,15 @@ func (b *backend) retrieveAccountRaw(ctx context.Context, req *logical.Request,
 func (b *backend) signRaw(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 
 	from := data.Get("name").(string)
+	sign, err := b.prepareSignRaw(data)
+	if err != nil {
+		return nil, err
+	}
+	return b.signWithAccount(ctx, req, from, sign)
+}
+
+// prepareSignRaw validates the signRaw input and returns the function signing it
+func (b *backend) prepareSignRaw(data *framework.FieldData) (signFunc, error) {
 	payloadStr := data.Get("payload").(string)
 
 	payload, err := hexutil.Decode(payloadStr)
@@ -278,8 +361,67 @@ func (b *backend) signRaw(ctx context.Context, req *logical.Request, data *frame
 		b.Logger().Error("Failed to decode payload", "error", err)
 		return nil, err
 	}
+	digest, err := hashPayload(payload, data.Get("hash").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	return func(account *Account, privateKey *ecdsa.PrivateKey) (map[string]interface{}, error) {
+		encoding := data.Get("encoding").(string)
+		result := map[string]interface{}{}
+		var sig []byte
+		var err error
+		switch scheme := data.Get("scheme").(string); scheme {
+		case SchemeECDSA:
+			sig, err = crypto.Sign(digest, privateKey)
+			if err != nil {
+				break
+			}
+			result["r"] = hexutil.Encode(sig[:32])
+			result["s"] = hexutil.Encode(sig[32:64])
+			var v *big.Int
+			sig, v, err = encodeECDSASignature(sig, encoding, ValidNumber(data.Get("chainId").(string)))
+			if err != nil {
+				return nil, err
+			}
+			result["v"] = hexutil.EncodeBig(v)
+		case SchemeSchnorr:
+			if encoding != "" && encoding != EncodingCompact {
+				return nil, fmt.Errorf("Signature encoding %s is not supported by the %s scheme", encoding, SchemeSchnorr)
+			}
+			// key-path spends of P2TR accounts are signed with the BIP-86 tweaked key
+			taprootTweak := account.TaprootInternalKey != "" && data.Get("taprootTweak").(bool)
+			sig, err = signSchnorr(privateKey, digest, data.Get("auxRand").(string), taprootTweak)
+			if err == nil {
+				result["r"] = hexutil.Encode(sig[:32])
+				result["s"] = hexutil.Encode(sig[32:])
+			}
+		default:
+			return nil, fmt.Errorf("Unsupported signature scheme %s", scheme)
+		}
+		if err != nil {
+			b.Logger().Error("Failed to sign the transaction object", "error", err)
+			return nil, err
+		}
+
+		result["digest"] = hexutil.Encode(digest)
+		result["signature"], err = formatSignature(sig, data.Get("format").(string))
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	}, nil
+}
+
+func (b *backend) signTx(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	from := data.Get("name").(string)
 
-	account, err := b.retrieveAccountRaw(ctx, req, from)
+	sign, err := b.prepareSignTx(data)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := b.retrieveAccount(ctx, req, from)
 	if err != nil {
 		b.Logger().Error("Failed to retrieve the signing account", "address", from, "error", err)
 		return nil, fmt.Errorf("Error retrieving signing account %s", from)
@@ -288,29 +430,22 @@ func (b *backend) signRaw(ctx context.Context, req *logical.Request, data *frame
 		return nil, fmt.Errorf("Signing account %s does not exist", from)
 	}
 
-	privateKey, err := crypto.HexToECDSA(account.PrivateKey)
+	privateKey, err := b.retrievePrivateKey(ctx, req, account)
 	if err != nil {
-		b.Logger().Error("Error reconstructing private key from retrieved hex", "error", err)
-		return nil, fmt.Errorf("Error reconstructing private key from retrieved hex")
+		return nil, err
 	}
 	defer ZeroKey(privateKey)
 
-	sig, err := crypto.Sign(payload[:], privateKey)
+	result, err := sign(account, privateKey)
 	if err != nil {
-		b.Logger().Error("Failed to sign the transaction object", "error", err)
 		return nil, err
 	}
-
-	return &logical.Response{
-		Data: map[string]interface{}{
-			"signature": hexutil.Encode(sig), //TODO - check format, now using hex for debug
-		},
-	}, nil
+	return &logical.Response{Data: result}, nil
 }
 
-func (b *backend) signTx(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	from := data.Get("name").(string)
-
+// prepareSignTx validates the transaction fields and builds the transaction, returning the
+// function signing it
+func (b *backend) prepareSignTx(data *framework.FieldData) (signFunc, error) {
 	var txDataToSign []byte
 	dataInput := data.Get("data").(string)
 	// some client such as go-ethereum uses "input" instead of "data"
@@ -327,14 +462,6 @@ func (b *backend) signTx(ctx context.Context, req *logical.Request, data *framew
 		return nil, err
 	}
 
-	account, err := b.retrieveAccount(ctx, req, from)
-	if err != nil {
-		b.Logger().Error("Failed to retrieve the signing account", "address", from, "error", err)
-		return nil, fmt.Errorf("Error retrieving signing account %s", from)
-	}
-	if account == nil {
-		return nil, fmt.Errorf("Signing account %s does not exist", from)
-	}
 	amount := ValidNumber(data.Get("value").(string))
 	if amount == nil {
 		b.Logger().Error("Invalid amount for the 'value' field", "value", data.Get("value").(string))
@@ -350,51 +477,131 @@ func (b *backend) signTx(ctx context.Context, req *logical.Request, data *framew
 	}
 
 	gasLimitIn := ValidNumber(data.Get("gas").(string))
-	if gasLimitIn == nil {
+	if gasLimitIn == nil || !gasLimitIn.IsUint64() {
 		b.Logger().Error("Invalid gas limit", "gas", data.Get("gas").(string))
 		return nil, fmt.Errorf("Invalid gas limit")
 	}
 	gasLimit := gasLimitIn.Uint64()
 
-	gasPrice := ValidNumber(data.Get("gasPrice").(string))
-
-	privateKey, err := crypto.HexToECDSA(account.PrivateKey)
-	if err != nil {
-		b.Logger().Error("Error reconstructing private key from retrieved hex", "error", err)
-		return nil, fmt.Errorf("Error reconstructing private key from retrieved hex")
+	txType := ValidNumber(data.Get("type").(string))
+	if txType == nil || !txType.IsUint64() {
+		b.Logger().Error("Invalid transaction type", "type", data.Get("type").(string))
+		return nil, fmt.Errorf("Invalid transaction type")
 	}
-	defer ZeroKey(privateKey)
 
 	nonceIn := ValidNumber(data.Get("nonce").(string))
-	var nonce uint64
-	nonce = nonceIn.Uint64()
+	if nonceIn == nil || !nonceIn.IsUint64() {
+		b.Logger().Error("Invalid nonce", "nonce", data.Get("nonce").(string))
+		return nil, fmt.Errorf("Invalid 'nonce' value")
+	}
+	nonce := nonceIn.Uint64()
 
-	var tx *types.Transaction
-	if rawAddressTo == "" {
-		tx = types.NewContractCreation(nonce, amount, gasLimit, gasPrice, txDataToSign)
-	} else {
+	params := &txParams{
+		chainId:  chainId,
+		nonce:    nonce,
+		value:    amount,
+		gasLimit: gasLimit,
+		data:     txDataToSign,
+	}
+	if rawAddressTo != "" {
 		toAddress := common.HexToAddress(rawAddressTo)
-		tx = types.NewTransaction(nonce, toAddress, amount, gasLimit, gasPrice, txDataToSign)
+		params.to = &toAddress
 	}
-	var signer types.Signer
-	if big.NewInt(0).Cmp(chainId) == 0 {
-		signer = types.HomesteadSigner{}
-	} else {
-		signer = types.NewEIP155Signer(chainId)
+
+	tx, signer, err := buildTransaction(txType.Uint64(), params, data)
+	if err != nil {
+		b.Logger().Error("Failed to build the transaction object", "error", err)
+		return nil, err
 	}
-	signedTx, err := types.SignTx(tx, signer, privateKey)
+
+	return func(account *Account, privateKey *ecdsa.PrivateKey) (map[string]interface{}, error) {
+		signedTx, err := types.SignTx(tx, signer, privateKey)
+		if err != nil {
+			b.Logger().Error("Failed to sign the transaction object", "error", err)
+			return nil, err
+		}
+
+		// legacy transactions are plain RLP, typed transactions use the EIP-2718 envelope
+		signedTxBytes, err := signedTx.WithoutBlobTxSidecar().MarshalBinary()
+		if err != nil {
+			b.Logger().Error("Failed to encode the signed transaction", "error", err)
+			return nil, err
+		}
+
+		result := map[string]interface{}{
+			"transaction_hash":   signedTx.Hash().Hex(),
+			"signed_transaction": hexutil.Encode(signedTxBytes),
+		}
+		if signedTx.BlobTxSidecar() != nil {
+			// blob transactions are gossiped with the blobs, commitments and proofs attached
+			networkTxBytes, err := signedTx.MarshalBinary()
+			if err != nil {
+				b.Logger().Error("Failed to encode the signed transaction with its blob sidecar", "error", err)
+				return nil, err
+			}
+			result["network_transaction"] = hexutil.Encode(networkTxBytes)
+		}
+		return result, nil
+	}, nil
+}
+
+func (b *backend) signAuthorization(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	from := data.Get("name").(string)
+
+	account, err := b.retrieveAccount(ctx, req, from)
+	if err != nil {
+		b.Logger().Error("Failed to retrieve the signing account", "address", from, "error", err)
+		return nil, fmt.Errorf("Error retrieving signing account %s", from)
+	}
+	if account == nil {
+		return nil, fmt.Errorf("Signing account %s does not exist", from)
+	}
+
+	chainId := ValidNumber(data.Get("chainId").(string))
+	if chainId == nil {
+		b.Logger().Error("Invalid chainId", "chainId", data.Get("chainId").(string))
+		return nil, fmt.Errorf("Invalid 'chainId' value")
+	}
+	authChainId, overflow := uint256.FromBig(chainId)
+	if overflow {
+		return nil, fmt.Errorf("Invalid 'chainId' value")
+	}
+
+	rawAddress := data.Get("address").(string)
+	if !common.IsHexAddress(rawAddress) {
+		b.Logger().Error("Invalid delegation address", "address", rawAddress)
+		return nil, fmt.Errorf("Invalid 'address' value")
+	}
+
+	nonce := ValidNumber(data.Get("nonce").(string))
+	if nonce == nil || !nonce.IsUint64() {
+		b.Logger().Error("Invalid nonce", "nonce", data.Get("nonce").(string))
+		return nil, fmt.Errorf("Invalid 'nonce' value")
+	}
+
+	privateKey, err := b.retrievePrivateKey(ctx, req, account)
 	if err != nil {
-		b.Logger().Error("Failed to sign the transaction object", "error", err)
 		return nil, err
 	}
+	defer ZeroKey(privateKey)
 
-	var signedTxBuff bytes.Buffer
-	signedTx.EncodeRLP(&signedTxBuff)
+	auth, err := types.SignSetCode(privateKey, types.SetCodeAuthorization{
+		ChainID: *authChainId,
+		Address: common.HexToAddress(rawAddress),
+		Nonce:   nonce.Uint64(),
+	})
+	if err != nil {
+		b.Logger().Error("Failed to sign the authorization", "error", err)
+		return nil, err
+	}
+	authJSON, _ := json.Marshal(auth)
 
 	return &logical.Response{
 		Data: map[string]interface{}{
-			"transaction_hash":   signedTx.Hash().Hex(),
-			"signed_transaction": hexutil.Encode(signedTxBuff.Bytes()),
+			"authorization": string(authJSON),
+			"yParity":       hexutil.EncodeUint64(uint64(auth.V)),
+			"r":             hexutil.EncodeBig(auth.R.ToBig()),
+			"s":             hexutil.EncodeBig(auth.S.ToBig()),
 		},
 	}, nil
 }
@@ -407,7 +614,10 @@ func ValidNumber(input string) *big.Int {
 	if !matched || err != nil {
 		return nil
 	}
-	amount := math.MustParseBig256(input)
+	amount, ok := math.ParseBig256(input)
+	if !ok {
+		return nil
+	}
 	return amount.Abs(amount)
 }
 
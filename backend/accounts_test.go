@@ -17,6 +17,7 @@ package backend
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"math/big"
 	"reflect"
@@ -295,6 +296,335 @@ func TestAccounts(t *testing.T) {
 	assert.Equal(1, len(resp.Data))
 }
 
+func TestSignDynamicFeeTx(t *testing.T) {
+	assert := assert.New(t)
+
+	b, _ := getBackend(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "accounts")
+	storage := req.Storage
+	req.Data = map[string]interface{}{
+		"privateKey": "ec85999367d32fbbe02dd600a2a44550b95274cc67d14375a9f0bce233f13ad2",
+	}
+	res, err := b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	address := res.Data["address"].(string)
+
+	req = logical.TestRequest(t, logical.CreateOperation, "accounts/"+address+"/sign")
+	req.Storage = storage
+	req.Data = map[string]interface{}{
+		"type":                 "0x2",
+		"data":                 "60fe47b10000000000000000000000000000000000000000000000000000000000000014",
+		"to":                   "0xf809410b0d6f047c603deb311979cd413e025a84",
+		"gas":                  50000,
+		"nonce":                "0x3",
+		"chainId":              12345,
+		"maxFeePerGas":         "30000000000",
+		"maxPriorityFeePerGas": "1000000000",
+		"accessList":           `[{"address":"0xf809410b0d6f047c603deb311979cd413e025a84","storageKeys":["0x0000000000000000000000000000000000000000000000000000000000000001"]}]`,
+	}
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	signedTx := resp.Data["signed_transaction"].(string)
+	assert.True(strings.HasPrefix(signedTx, "0x02"))
+
+	txBytes, _ := hexutil.Decode(signedTx)
+	var tx types.Transaction
+	err = tx.UnmarshalBinary(txBytes)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	assert.Equal(uint8(types.DynamicFeeTxType), tx.Type())
+	assert.Equal(big.NewInt(30000000000), tx.GasFeeCap())
+	assert.Equal(big.NewInt(1000000000), tx.GasTipCap())
+	assert.Equal(1, len(tx.AccessList()))
+	assert.Equal(resp.Data["transaction_hash"].(string), tx.Hash().Hex())
+
+	sender, _ := types.Sender(types.NewLondonSigner(big.NewInt(12345)), &tx)
+	assert.Equal(address, strings.ToLower(sender.Hex()))
+
+	// typed transactions cannot be replay-unprotected
+	req.Data["chainId"] = 0
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.Equal("'chainId' is required for typed transactions", err.Error())
+
+	req.Data["chainId"] = 12345
+	req.Data["maxFeePerGas"] = "1"
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.Equal("'maxFeePerGas' must not be lower than 'maxPriorityFeePerGas'", err.Error())
+
+	// malformed numbers are rejected instead of failing the request handler
+	req.Data["maxFeePerGas"] = "1e9"
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.Equal("Invalid 'maxFeePerGas' value", err.Error())
+
+	req.Data["maxFeePerGas"] = "30000000000"
+	for _, nonce := range []string{"1e9", "abc", "18446744073709551616"} {
+		req.Data["nonce"] = nonce
+		_, err = b.HandleRequest(context.Background(), req)
+		assert.Equal("Invalid 'nonce' value", err.Error(), nonce)
+	}
+
+	// gas limits beyond 64 bits are rejected rather than truncated
+	req.Data["nonce"] = "0x3"
+	req.Data["gas"] = "18446744073709551616"
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.Equal("Invalid gas limit", err.Error())
+	req.Data["gas"] = "50000"
+
+	req.Data["maxFeePerGas"] = "30000000000"
+	req.Data["type"] = "5"
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.Equal("Unsupported transaction type 5", err.Error())
+}
+
+func TestSignAccessListTx(t *testing.T) {
+	assert := assert.New(t)
+
+	b, _ := getBackend(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "accounts")
+	storage := req.Storage
+	req.Data = map[string]interface{}{
+		"privateKey": "ec85999367d32fbbe02dd600a2a44550b95274cc67d14375a9f0bce233f13ad2",
+	}
+	res, err := b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	address := res.Data["address"].(string)
+
+	req = logical.TestRequest(t, logical.CreateOperation, "accounts/"+address+"/sign")
+	req.Storage = storage
+	req.Data = map[string]interface{}{
+		"type":       1,
+		"data":       "60fe47b10000000000000000000000000000000000000000000000000000000000000014",
+		"to":         "0xf809410b0d6f047c603deb311979cd413e025a84",
+		"gas":        50000,
+		"nonce":      "0x3",
+		"gasPrice":   "20000000000",
+		"chainId":    12345,
+		"accessList": `[{"address":"0xf809410b0d6f047c603deb311979cd413e025a84","storageKeys":["0x0000000000000000000000000000000000000000000000000000000000000001","0x0000000000000000000000000000000000000000000000000000000000000002"]}]`,
+	}
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	txBytes, _ := hexutil.Decode(resp.Data["signed_transaction"].(string))
+	var tx types.Transaction
+	err = tx.UnmarshalBinary(txBytes)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	assert.Equal(uint8(types.AccessListTxType), tx.Type())
+	assert.Equal(big.NewInt(20000000000), tx.GasPrice())
+	assert.Equal(2, len(tx.AccessList()[0].StorageKeys))
+
+	sender, _ := types.Sender(types.NewEIP2930Signer(big.NewInt(12345)), &tx)
+	assert.Equal(address, strings.ToLower(sender.Hex()))
+
+	req.Data["accessList"] = `{"address":"0xf809410b0d6f047c603deb311979cd413e025a84"}`
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.Equal(`Invalid 'accessList' value: must be a JSON array of {"address", "storageKeys"} objects`, err.Error())
+
+	req.Data["accessList"] = `[{"address":"0xf809410b0d6f047c603deb311979cd413e025a84"}]`
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.Equal("Invalid 'accessList' value: entry 0: missing required field 'storageKeys' for AccessTuple", err.Error())
+
+	req.Data["accessList"] = `[{"address":"0xf809410b0d6f047c603deb311979cd413e025a84","storageKeys":[],"slots":[]}]`
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.Equal("Invalid 'accessList' value: entry 0 has unknown field 'slots'", err.Error())
+
+	req.Data["accessList"] = `[{"address":"0xf809","storageKeys":[]}]`
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.True(strings.HasPrefix(err.Error(), "Invalid 'accessList' value: entry 0: "))
+
+	req.Data["type"] = 0
+	req.Data["accessList"] = `[]`
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.Equal("'accessList' is not supported by legacy transactions, use type 1 or 2", err.Error())
+}
+
+func TestSignBlobTx(t *testing.T) {
+	assert := assert.New(t)
+
+	b, _ := getBackend(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "accounts")
+	storage := req.Storage
+	req.Data = map[string]interface{}{
+		"privateKey": "ec85999367d32fbbe02dd600a2a44550b95274cc67d14375a9f0bce233f13ad2",
+	}
+	res, err := b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	address := res.Data["address"].(string)
+
+	// an all-zero blob is a valid set of field elements
+	blob := "0x" + strings.Repeat("00", 131072)
+
+	req = logical.TestRequest(t, logical.CreateOperation, "accounts/"+address+"/sign")
+	req.Storage = storage
+	req.Data = map[string]interface{}{
+		"type":                 3,
+		"data":                 "0x",
+		"to":                   "0xf809410b0d6f047c603deb311979cd413e025a84",
+		"gas":                  21000,
+		"nonce":                "0x3",
+		"chainId":              12345,
+		"maxFeePerGas":         "30000000000",
+		"maxPriorityFeePerGas": "1000000000",
+		"maxFeePerBlobGas":     "1000000000",
+		"blobs":                []string{blob},
+	}
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	txBytes, _ := hexutil.Decode(resp.Data["signed_transaction"].(string))
+	var tx types.Transaction
+	err = tx.UnmarshalBinary(txBytes)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	assert.Equal(uint8(types.BlobTxType), tx.Type())
+	assert.Nil(tx.BlobTxSidecar())
+	assert.Equal(1, len(tx.BlobHashes()))
+	assert.Equal(big.NewInt(1000000000), tx.BlobGasFeeCap())
+
+	sender, _ := types.Sender(types.NewCancunSigner(big.NewInt(12345)), &tx)
+	assert.Equal(address, strings.ToLower(sender.Hex()))
+
+	networkTxBytes, _ := hexutil.Decode(resp.Data["network_transaction"].(string))
+	var networkTx types.Transaction
+	err = networkTx.UnmarshalBinary(networkTxBytes)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	assert.Equal(tx.Hash(), networkTx.Hash())
+	assert.Equal(1, len(networkTx.BlobTxSidecar().Blobs))
+	assert.Equal(tx.BlobHashes(), networkTx.BlobTxSidecar().BlobHashes())
+
+	// signing with only the versioned hashes returns no network form
+	versionedHash := tx.BlobHashes()[0].Hex()
+	delete(req.Data, "blobs")
+	req.Data["blobVersionedHashes"] = []string{versionedHash}
+	resp, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	assert.Equal(tx.Hash().Hex(), resp.Data["transaction_hash"].(string))
+	assert.Nil(resp.Data["network_transaction"])
+
+	req.Data["blobVersionedHashes"] = []string{"0x02" + versionedHash[4:]}
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.Equal("Invalid 'blobVersionedHashes' value at index 0", err.Error())
+
+	req.Data["blobVersionedHashes"] = []string{"0x01" + strings.Repeat("00", 31)}
+	req.Data["blobs"] = []string{blob}
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.Equal("'blobVersionedHashes' value at index 0 does not match the blob commitment", err.Error())
+
+	delete(req.Data, "blobs")
+	delete(req.Data, "blobVersionedHashes")
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.Equal("Blob transactions require 'blobVersionedHashes' or 'blobs'", err.Error())
+
+	req.Data["blobs"] = []string{"0x00"}
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.Equal("Invalid 'blobs' value at index 0, each blob must be 131072 bytes", err.Error())
+
+	delete(req.Data, "to")
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.Equal("'to' is required for blob transactions", err.Error())
+}
+
+func TestSignSetCodeTx(t *testing.T) {
+	assert := assert.New(t)
+
+	b, _ := getBackend(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "accounts")
+	storage := req.Storage
+	req.Data = map[string]interface{}{
+		"privateKey": "ec85999367d32fbbe02dd600a2a44550b95274cc67d14375a9f0bce233f13ad2",
+	}
+	res, err := b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	address := res.Data["address"].(string)
+
+	req = logical.TestRequest(t, logical.CreateOperation, "accounts/"+address+"/sign-authorization")
+	req.Storage = storage
+	req.Data = map[string]interface{}{
+		"chainId": 12345,
+		"address": "0xf809410b0d6f047c603deb311979cd413e025a84",
+		"nonce":   "4",
+	}
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	authorization := resp.Data["authorization"].(string)
+	var auth types.SetCodeAuthorization
+	err = json.Unmarshal([]byte(authorization), &auth)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	authority, _ := auth.Authority()
+	assert.Equal(address, strings.ToLower(authority.Hex()))
+	assert.Equal(uint64(4), auth.Nonce)
+	assert.Equal(hexutil.EncodeBig(auth.R.ToBig()), resp.Data["r"].(string))
+
+	req.Data["address"] = "0xf809"
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.Equal("Invalid 'address' value", err.Error())
+
+	req = logical.TestRequest(t, logical.CreateOperation, "accounts/"+address+"/sign")
+	req.Storage = storage
+	req.Data = map[string]interface{}{
+		"type":                 4,
+		"data":                 "0x",
+		"to":                   address,
+		"gas":                  100000,
+		"nonce":                "0x3",
+		"chainId":              12345,
+		"maxFeePerGas":         "30000000000",
+		"maxPriorityFeePerGas": "1000000000",
+		"authorizationList":    "[" + authorization + "]",
+	}
+	resp, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	txBytes, _ := hexutil.Decode(resp.Data["signed_transaction"].(string))
+	var tx types.Transaction
+	err = tx.UnmarshalBinary(txBytes)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	assert.Equal(uint8(types.SetCodeTxType), tx.Type())
+	assert.Equal([]types.SetCodeAuthorization{auth}, tx.SetCodeAuthorizations())
+
+	sender, _ := types.Sender(types.NewPragueSigner(big.NewInt(12345)), &tx)
+	assert.Equal(address, strings.ToLower(sender.Hex()))
+
+	req.Data["authorizationList"] = "[]"
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.Equal("Set code transactions require a non-empty 'authorizationList'", err.Error())
+
+	req.Data["authorizationList"] = `[{"address":"0xf809410b0d6f047c603deb311979cd413e025a84"}]`
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.Equal("Invalid 'authorizationList' value: missing required field 'chainId' for SetCodeAuthorization", err.Error())
+}
+
 func TestListAccountsFailure1(t *testing.T) {
 	assert := assert.New(t)
 
@@ -0,0 +1,217 @@
+// Copyright © 2020 Kaleido
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/bech32"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/okx/go-wallet-sdk/coins/tron"
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	// AddressTypeETH is the default address type
+	AddressTypeETH string = "ETH"
+	// AddressTypeTRON is a Tron base58 address
+	AddressTypeTRON string = "TRON"
+	// AddressTypeCOSMOS is a Cosmos SDK bech32 account address
+	AddressTypeCOSMOS string = "COSMOS"
+	// AddressTypeBCH is a Bitcoin Cash P2PKH CashAddr, without the bitcoincash: prefix
+	AddressTypeBCH string = "BCH"
+	// AddressTypeXRPL is an XRP Ledger classic address
+	AddressTypeXRPL string = "XRPL"
+)
+
+// defaultCosmosHrp is the human readable part of the Cosmos Hub addresses
+const defaultCosmosHrp = "cosmos"
+
+var cosmosHrpRegex = regexp.MustCompile("^[a-z0-9]{1,40}$")
+
+// bitcoin script templates an address can pay to
+const (
+	scriptP2PKH  = "P2PKH"
+	scriptP2WPKH = "P2WPKH"
+	scriptP2TR   = "P2TR"
+	// P2WPKH nested in P2SH, for wallets that only accept script hash addresses
+	scriptP2SHP2WPKH = "P2SH-P2WPKH"
+	// P2PKH of the compressed public key, as the Litecoin and Dogecoin wallets use
+	scriptP2PKHCompressed = "P2PKH-Compressed"
+)
+
+// bitcoinAddressType binds a script template to the network it is encoded for
+type bitcoinAddressType struct {
+	script string
+	params *chaincfg.Params
+}
+
+// bitcoinAddressTypes lists the supported Bitcoin style 'addressType' values
+var bitcoinAddressTypes = map[string]bitcoinAddressType{
+	"P2PKH":          {scriptP2PKH, &chaincfg.MainNetParams},
+	"P2PKH-Testnet":  {scriptP2PKH, &chaincfg.TestNet3Params},
+	"P2WPKH":         {scriptP2WPKH, &chaincfg.MainNetParams},
+	"P2WPKH-Testnet": {scriptP2WPKH, &chaincfg.TestNet3Params},
+	"P2WPKH-Regtest": {scriptP2WPKH, &chaincfg.RegressionNetParams},
+	"P2TR":           {scriptP2TR, &chaincfg.MainNetParams},
+	"P2TR-Testnet":   {scriptP2TR, &chaincfg.TestNet3Params},
+	"P2TR-Regtest":   {scriptP2TR, &chaincfg.RegressionNetParams},
+
+	"P2SH-P2WPKH":         {scriptP2SHP2WPKH, &chaincfg.MainNetParams},
+	"P2SH-P2WPKH-Testnet": {scriptP2SHP2WPKH, &chaincfg.TestNet3Params},
+	"P2SH-P2WPKH-Regtest": {scriptP2SHP2WPKH, &chaincfg.RegressionNetParams},
+
+	"LTC-P2PKH":       {scriptP2PKHCompressed, &litecoinMainNetParams},
+	"LTC-P2WPKH":      {scriptP2WPKH, &litecoinMainNetParams},
+	"LTC-P2SH-P2WPKH": {scriptP2SHP2WPKH, &litecoinMainNetParams},
+	"DOGE-P2PKH":      {scriptP2PKHCompressed, &dogecoinMainNetParams},
+}
+
+// litecoinMainNetParams only holds the address encoding of the Litecoin main network, the
+// transactions are signed the same way as Bitcoin ones
+var litecoinMainNetParams = chaincfg.Params{
+	Name:             "litecoin",
+	PubKeyHashAddrID: 0x30, // L
+	ScriptHashAddrID: 0x32, // M
+	Bech32HRPSegwit:  "ltc",
+}
+
+// dogecoinMainNetParams only holds the address encoding of the Dogecoin main network, which has
+// no segwit
+var dogecoinMainNetParams = chaincfg.Params{
+	Name:             "dogecoin",
+	PubKeyHashAddrID: 0x1e, // D
+	ScriptHashAddrID: 0x16, // 9 or A
+}
+
+// isTaprootAddressType tells whether accounts of this type spend through a BIP-86 tweaked key
+func isTaprootAddressType(addressType string) bool {
+	return bitcoinAddressTypes[addressType].script == scriptP2TR
+}
+
+// redeemScript returns the P2SH redeem script for address types that need one, nil otherwise
+func redeemScript(addressType string, publicKey *btcec.PublicKey) []byte {
+	if bitcoinAddressTypes[addressType].script != scriptP2SHP2WPKH {
+		return nil
+	}
+	return payToWitnessPubKeyHashScript(publicKey.SerializeCompressed())
+}
+
+// deriveAddress encodes the public key as an address of the given type, an empty type means ETH.
+// P2PKH addresses hash the uncompressed public key unless compressed is set, as for HD wallet keys.
+func deriveAddress(addressType string, publicKey *btcec.PublicKey, compressed bool) (string, error) {
+	switch addressType {
+	case "", AddressTypeETH:
+		hash := sha3.NewLegacyKeccak256()
+		hash.Write(publicKey.SerializeUncompressed()[1:])
+		return hexutil.Encode(hash.Sum(nil)[12:]), nil
+	case AddressTypeTRON:
+		return tron.GetAddress(publicKey), nil
+	case AddressTypeCOSMOS:
+		return cosmosAddress(defaultCosmosHrp, publicKey)
+	case AddressTypeBCH:
+		// Bitcoin Cash wallets hash the compressed public key
+		return encodeCashAddr(bitcoinCashPrefix, cashAddrP2PKH, btcutil.Hash160(publicKey.SerializeCompressed())), nil
+	case AddressTypeXRPL:
+		return xrplAddress(publicKey), nil
+	}
+
+	btcType, ok := bitcoinAddressTypes[addressType]
+	if !ok {
+		return "", fmt.Errorf("Unsupported addressType %s", addressType)
+	}
+
+	var addr btcutil.Address
+	var err error
+	switch btcType.script {
+	case scriptP2PKH, scriptP2PKHCompressed:
+		// legacy Bitcoin addresses of imported keys hash the uncompressed public key
+		pubKey := publicKey.SerializeUncompressed()
+		if compressed || btcType.script == scriptP2PKHCompressed {
+			pubKey = publicKey.SerializeCompressed()
+		}
+		addr, err = btcutil.NewAddressPubKeyHash(btcutil.Hash160(pubKey), btcType.params)
+	case scriptP2WPKH:
+		// segwit only allows compressed public keys
+		addr, err = btcutil.NewAddressWitnessPubKeyHash(btcutil.Hash160(publicKey.SerializeCompressed()), btcType.params)
+	case scriptP2TR:
+		// BIP-86 key-path-only output, the account key is the internal key
+		outputKey := txscript.ComputeTaprootKeyNoScript(publicKey)
+		addr, err = btcutil.NewAddressTaproot(schnorr.SerializePubKey(outputKey), btcType.params)
+	case scriptP2SHP2WPKH:
+		addr, err = btcutil.NewAddressScriptHash(redeemScript(addressType, publicKey), btcType.params)
+	}
+	if err != nil {
+		return "", err
+	}
+	return addr.EncodeAddress(), nil
+}
+
+// cosmosAddress encodes the public key as a Cosmos SDK account address with the human readable
+// part of the chain, the address bytes are RIPEMD160(SHA256(compressed public key))
+func cosmosAddress(hrp string, publicKey *btcec.PublicKey) (string, error) {
+	if !cosmosHrpRegex.MatchString(hrp) {
+		return "", fmt.Errorf("Invalid 'hrp' value %s, it must be lower case letters and digits", hrp)
+	}
+	converted, err := bech32.ConvertBits(btcutil.Hash160(publicKey.SerializeCompressed()), 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+	return bech32.Encode(hrp, converted)
+}
+
+// accountAddressForms returns the other forms of the account address to show along with it: the
+// prefixed CashAddr and the legacy address of BCH accounts, since the prefix can't be part of
+// the account paths
+func accountAddressForms(account *Account) (map[string]interface{}, error) {
+	if account.AddressType != AddressTypeBCH {
+		return nil, nil
+	}
+	pub, err := parseAccountPublicKey(account)
+	if err != nil {
+		return nil, err
+	}
+	legacy, err := btcutil.NewAddressPubKeyHash(btcutil.Hash160(pub.SerializeCompressed()), &chaincfg.MainNetParams)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"cashAddress":   bitcoinCashPrefix + ":" + account.Address,
+		"legacyAddress": legacy.EncodeAddress(),
+	}, nil
+}
+
+// allAddresses encodes the public key with every supported address type
+func allAddresses(publicKey *btcec.PublicKey) (map[string]interface{}, error) {
+	addresses := map[string]interface{}{}
+	addressTypes := []string{AddressTypeETH, AddressTypeTRON, AddressTypeCOSMOS, AddressTypeBCH, AddressTypeXRPL}
+	for addressType := range bitcoinAddressTypes {
+		addressTypes = append(addressTypes, addressType)
+	}
+	for _, addressType := range addressTypes {
+		address, err := deriveAddress(addressType, publicKey, false)
+		if err != nil {
+			return nil, err
+		}
+		addresses[addressType] = address
+	}
+	return addresses, nil
+}
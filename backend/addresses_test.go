@@ -0,0 +1,243 @@
+package backend
+
+import (
+	"context"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+)
+
+func createAccountWithType(t *testing.T, b logical.Backend, storage logical.Storage, privateKey string, addressType string) (*logical.Response, error) {
+	req := logical.TestRequest(t, logical.UpdateOperation, "accounts")
+	req.Storage = storage
+	req.Data = map[string]interface{}{
+		"privateKey":  privateKey,
+		"addressType": addressType,
+	}
+	return b.HandleRequest(context.Background(), req)
+}
+
+func TestSegwitAddresses(t *testing.T) {
+	assert := assert.New(t)
+
+	b, storage := getBackend(t)
+
+	// the public key of private key 1 is the generator point, as used by the BIP-173 examples
+	key := "0000000000000000000000000000000000000000000000000000000000000001"
+	for addressType, expected := range map[string]string{
+		"P2WPKH":         "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4",
+		"P2WPKH-Testnet": "tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx",
+		"P2WPKH-Regtest": "bcrt1qw508d6qejxtdg4y5r3zarvary0c5xw7kygt080",
+	} {
+		res, err := createAccountWithType(t, b, storage, key, addressType)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		assert.Equal(expected, res.Data["address"].(string), addressType)
+	}
+}
+
+func TestUnknownAddressType(t *testing.T) {
+	assert := assert.New(t)
+
+	b, storage := getBackend(t)
+
+	_, err := createAccountWithType(t, b, storage, "", "P2WSH")
+	assert.Equal("Unsupported addressType P2WSH", err.Error())
+
+	req := logical.TestRequest(t, logical.ListOperation, "accounts")
+	req.Storage = storage
+	res, err := b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	assert.Nil(res.Data["keys"])
+}
+
+func TestTaprootAddress(t *testing.T) {
+	assert := assert.New(t)
+
+	b, storage := getBackend(t)
+
+	// m/86'/0'/0'/0/0 from the BIP-86 test vectors
+	res, err := createAccountWithType(t, b, storage, "41f41d69260df4cf277826a9b65a3717e4eeddbeedf637f212ca096576479361", "P2TR")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	address := res.Data["address"].(string)
+	assert.Equal("bc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr", address)
+
+	req := logical.TestRequest(t, logical.ReadOperation, "accounts/"+address)
+	req.Storage = storage
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	assert.Equal("P2TR", res.Data["addressType"].(string))
+	assert.Equal("cc8a4bc64d897bddc5fbc2f670f7a8ba0b386779106cf1223c6fc5d7cd6fc115", res.Data["taprootInternalKey"].(string))
+
+	digest := "0x243f6a8885a308d313198a2e03707344a4093822299f31d0082efa98ec4e6c89"
+	digestBytes, _ := hexutil.Decode(digest)
+
+	// key-path spends verify against the tweaked output key
+	req = logical.TestRequest(t, logical.CreateOperation, "accounts/"+address+"/signRaw")
+	req.Storage = storage
+	req.Data = map[string]interface{}{
+		"payload": digest,
+		"scheme":  "schnorr",
+	}
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	outputKeyBytes, _ := hexutil.Decode("0xa60869f0dbcf1dc659c9cecbaf8050135ea9e8cdc487053f1dc6880949dc684c")
+	outputKey, _ := schnorr.ParsePubKey(outputKeyBytes)
+	sigBytes, _ := hexutil.Decode(res.Data["signature"].(string))
+	sig, _ := schnorr.ParseSignature(sigBytes)
+	assert.True(sig.Verify(digestBytes, outputKey))
+
+	// the untweaked internal key can still be used explicitly
+	req.Data["taprootTweak"] = false
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	internalKeyBytes, _ := hexutil.Decode("0xcc8a4bc64d897bddc5fbc2f670f7a8ba0b386779106cf1223c6fc5d7cd6fc115")
+	internalKey, _ := schnorr.ParsePubKey(internalKeyBytes)
+	sigBytes, _ = hexutil.Decode(res.Data["signature"].(string))
+	sig, _ = schnorr.ParseSignature(sigBytes)
+	assert.True(sig.Verify(digestBytes, internalKey))
+	assert.False(sig.Verify(digestBytes, outputKey))
+}
+
+func TestNestedSegwitAddress(t *testing.T) {
+	assert := assert.New(t)
+
+	b, storage := getBackend(t)
+
+	// m/49'/1'/0'/0/0 from the BIP-49 test vectors
+	res, err := createAccountWithType(t, b, storage, "c9bdb49cfbaedca21c4b1f3a7803c34636b1d7dc55a717132443fc3f4c5867e8", "P2SH-P2WPKH-Testnet")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	address := res.Data["address"].(string)
+	assert.Equal("2Mww8dCYPUpKHofjgcXcBCEGmniw9CoaiD2", address)
+
+	req := logical.TestRequest(t, logical.ReadOperation, "accounts/"+address)
+	req.Storage = storage
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	assert.Equal("001438971f73930f6c141d977ac4fd4a727c854935b3", res.Data["redeemScript"].(string))
+
+	res, err = createAccountWithType(t, b, storage, "c9bdb49cfbaedca21c4b1f3a7803c34636b1d7dc55a717132443fc3f4c5867e8", "P2SH-P2WPKH")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	assert.Equal("3", res.Data["address"].(string)[:1])
+}
+
+func TestLitecoinDogecoinAddresses(t *testing.T) {
+	assert := assert.New(t)
+
+	b, storage := getBackend(t)
+
+	// all the addresses hash the compressed generator point, like the Litecoin and Dogecoin wallets
+	key := "0000000000000000000000000000000000000000000000000000000000000001"
+	for addressType, expected := range map[string]string{
+		"LTC-P2PKH":       "LVuDpNCSSj6pQ7t9Pv6d6sUkLKoqDEVUnJ",
+		"LTC-P2WPKH":      "ltc1qw508d6qejxtdg4y5r3zarvary0c5xw7kgmn4n9",
+		"LTC-P2SH-P2WPKH": "MR8UQSBr5ULwWheBHznrHk2jxyxkHQu8vB",
+		"DOGE-P2PKH":      "DFpN6QqFfUm3gKNaxN6tNcab1FArL9cZLE",
+	} {
+		res, err := createAccountWithType(t, b, storage, key, addressType)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		assert.Equal(expected, res.Data["address"].(string), addressType)
+	}
+
+	// m/84'/2'/0'/0/0 of the BIP-84 test mnemonic
+	req := logical.TestRequest(t, logical.CreateOperation, "wallets/w1")
+	req.Storage = storage
+	req.Data = map[string]interface{}{
+		"mnemonic": "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+	}
+	if _, err := b.HandleRequest(context.Background(), req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req = logical.TestRequest(t, logical.CreateOperation, "wallets/w1/derive")
+	req.Storage = storage
+	req.Data = map[string]interface{}{
+		"coin": 2,
+	}
+	res, err := b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	assert.Equal("ltc1qjmxnz78nmc8nq77wuxh25n2es7rzm5c2rkk4wh", res.Data["address"].(string))
+	assert.Equal("LTC-P2WPKH", res.Data["addressType"].(string))
+
+	// m/44'/3'/0'/0/0, as Dogecoin wallets derive it
+	req.Data = map[string]interface{}{
+		"coin": 3,
+	}
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	assert.Equal("DBus3bamQjgJULBJtYXpEzDWQRwF5iwxgC", res.Data["address"].(string))
+	assert.Equal("DOGE-P2PKH", res.Data["addressType"].(string))
+	assert.Equal("m/44'/3'/0'/0/0", res.Data["derivationPath"].(string))
+}
+
+func TestBitcoinCashAddress(t *testing.T) {
+	assert := assert.New(t)
+
+	b, storage := getBackend(t)
+
+	res, err := createAccountWithType(t, b, storage, "0000000000000000000000000000000000000000000000000000000000000001", "BCH")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	// the prefix is left out of the address, which names the account in the paths
+	address := res.Data["address"].(string)
+	assert.Equal("qp63uahgrxged4z5jswyt5dn5v3lzsem6cy4spdc2h", address)
+	assert.Equal("bitcoincash:qp63uahgrxged4z5jswyt5dn5v3lzsem6cy4spdc2h", res.Data["cashAddress"].(string))
+	assert.Equal("1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMH", res.Data["legacyAddress"].(string))
+
+	req := logical.TestRequest(t, logical.ReadOperation, "accounts/"+address)
+	req.Storage = storage
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	assert.Equal("BCH", res.Data["addressType"].(string))
+	assert.Equal("bitcoincash:qp63uahgrxged4z5jswyt5dn5v3lzsem6cy4spdc2h", res.Data["cashAddress"].(string))
+	assert.Equal("1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMH", res.Data["legacyAddress"].(string))
+
+	// coin 145 derives m/44'/145'/0'/0/index
+	req = logical.TestRequest(t, logical.CreateOperation, "wallets/w1")
+	req.Storage = storage
+	req.Data = map[string]interface{}{
+		"mnemonic": "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+	}
+	if _, err := b.HandleRequest(context.Background(), req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req = logical.TestRequest(t, logical.CreateOperation, "wallets/w1/derive")
+	req.Storage = storage
+	req.Data = map[string]interface{}{
+		"coin": 145,
+	}
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	assert.Equal("bitcoincash:qqyx49mu0kkn9ftfj6hje6g2wfer34yfnq5tahq3q6", res.Data["cashAddress"].(string))
+	assert.Equal("m/44'/145'/0'/0/0", res.Data["derivationPath"].(string))
+}
@@ -18,6 +18,7 @@ import (
 	"context"
 	"fmt"
 	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
@@ -44,6 +45,7 @@ func Backend(configMap map[string]string) (*backend, error) {
 		PathsSpecial: &logical.Paths{
 			SealWrapStorage: []string{
 				"accounts/",
+				"wallets/",
 			},
 		},
 		Secrets:     []*framework.Secret{},
@@ -51,6 +53,7 @@ func Backend(configMap map[string]string) (*backend, error) {
 	}
 
 	b.rsaProvider = NewRsaPgpProvider()
+	b.walletLocks = locksutil.CreateLocks()
 
 	return &b, nil
 }
@@ -59,6 +62,8 @@ func Backend(configMap map[string]string) (*backend, error) {
 type backend struct {
 	*framework.Backend
 	rsaProvider RsaProvider
+	// walletLocks serialize the changes of a wallet and of the list of its accounts
+	walletLocks []*locksutil.LockEntry
 }
 
 func (b *backend) pathExistenceCheck(ctx context.Context, req *logical.Request, data *framework.FieldData) (bool, error) {
@@ -0,0 +1,165 @@
+// Copyright © 2020 Kaleido
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// signFunc signs validated input with the decoded key of the account, and returns the response data
+type signFunc func(account *Account, privateKey *ecdsa.PrivateKey) (map[string]interface{}, error)
+
+// signWithAccount decodes the private key of the signing account to call the sign function with it
+func (b *backend) signWithAccount(ctx context.Context, req *logical.Request, from string, sign signFunc) (*logical.Response, error) {
+	account, err := b.retrieveAccountRaw(ctx, req, from)
+	if err != nil {
+		b.Logger().Error("Failed to retrieve the signing account", "address", from, "error", err)
+		return nil, fmt.Errorf("Error retrieving signing account %s", from)
+	}
+	if account == nil {
+		return nil, fmt.Errorf("Signing account %s does not exist", from)
+	}
+
+	privateKey, err := b.retrievePrivateKey(ctx, req, account)
+	if err != nil {
+		return nil, err
+	}
+	defer ZeroKey(privateKey)
+
+	result, err := sign(account, privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{Data: result}, nil
+}
+
+// batchItemType binds a batch item 'type' to the sign path whose fields the item takes
+type batchItemType struct {
+	path    func(b *backend) *framework.Path
+	prepare func(b *backend, data *framework.FieldData) (signFunc, error)
+	// ethOnly items are only signed by accounts with an Ethereum address, like their endpoint
+	ethOnly bool
+}
+
+var batchItemTypes = map[string]batchItemType{
+	"raw":         {pathSignRaw, (*backend).prepareSignRaw, false},
+	"message":     {pathSignMessage, (*backend).prepareSignMessage, false},
+	"typedData":   {pathSignTypedData, (*backend).prepareSignTypedData, false},
+	"transaction": {pathSign, (*backend).prepareSignTx, true},
+	"tron":        {pathSignTron, (*backend).prepareSignTron, false},
+	"cosmos":      {pathSignCosmos, (*backend).prepareSignCosmos, false},
+	"xrpl":        {pathSignXrpl, (*backend).prepareSignXrpl, false},
+}
+
+// batchTxTypeField carries the 'type' field of transaction items, since 'type' names the item type
+const batchTxTypeField = "txType"
+
+func (b *backend) signBatch(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	from := data.Get("name").(string)
+
+	// numbers are kept as strings so that large values don't lose precision
+	decoder := json.NewDecoder(strings.NewReader(data.Get("items").(string)))
+	decoder.UseNumber()
+	var items []map[string]interface{}
+	if err := decoder.Decode(&items); err != nil {
+		b.Logger().Error("Failed to decode the batch items", "error", err)
+		return nil, fmt.Errorf("Invalid 'items' value: %v", err)
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("'items' must be a non-empty JSON array")
+	}
+
+	account, err := b.retrieveAccountRaw(ctx, req, from)
+	if err != nil {
+		b.Logger().Error("Failed to retrieve the signing account", "address", from, "error", err)
+		return nil, fmt.Errorf("Error retrieving signing account %s", from)
+	}
+	if account == nil {
+		return nil, fmt.Errorf("Signing account %s does not exist", from)
+	}
+
+	privateKey, err := b.retrievePrivateKey(ctx, req, account)
+	if err != nil {
+		return nil, err
+	}
+	defer ZeroKey(privateKey)
+
+	schemas := map[string]map[string]*framework.FieldSchema{}
+	for name, itemType := range batchItemTypes {
+		schemas[name] = itemType.path(b).Fields
+	}
+
+	results := make([]map[string]interface{}, len(items))
+	for i, item := range items {
+		result, err := b.signBatchItem(item, from, schemas, account, privateKey)
+		if err != nil {
+			// one bad item does not fail the rest of the batch
+			result = map[string]interface{}{
+				"error": err.Error(),
+			}
+		}
+		results[i] = result
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"results": results,
+		},
+	}, nil
+}
+
+// signBatchItem validates the item against the schema of its sign path and signs it
+func (b *backend) signBatchItem(item map[string]interface{}, from string, schemas map[string]map[string]*framework.FieldSchema,
+	account *Account, privateKey *ecdsa.PrivateKey) (map[string]interface{}, error) {
+
+	name, _ := item["type"].(string)
+	itemType, ok := batchItemTypes[name]
+	if !ok {
+		return nil, fmt.Errorf("Unsupported item type %v", item["type"])
+	}
+	if itemType.ethOnly && !ethAddressRegex.MatchString(from) {
+		return nil, fmt.Errorf("Items of type %s can only be signed by accounts with an Ethereum address", name)
+	}
+
+	raw := make(map[string]interface{}, len(item))
+	for k, v := range item {
+		switch {
+		case k == "type":
+			// names the item type, not a field of the sign path
+		case k == batchTxTypeField && name == "transaction":
+			raw["type"] = v
+		default:
+			raw[k] = v
+		}
+	}
+	raw["name"] = from
+	fields := &framework.FieldData{Raw: raw, Schema: schemas[name]}
+	if err := fields.ValidateStrict(); err != nil {
+		return nil, fmt.Errorf("Invalid item: %v", err)
+	}
+
+	sign, err := itemType.prepare(b, fields)
+	if err != nil {
+		return nil, err
+	}
+	return sign(account, privateKey)
+}
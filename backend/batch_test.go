@@ -0,0 +1,130 @@
+package backend
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignBatch(t *testing.T) {
+	assert := assert.New(t)
+
+	b, storage := getBackend(t)
+
+	res, err := createAccountWithType(t, b, storage, "ec85999367d32fbbe02dd600a2a44550b95274cc67d14375a9f0bce233f13ad2", "ETH")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	address := res.Data["address"].(string)
+
+	// the batch gives the same deterministic signatures as the individual endpoints
+	single := func(path string, data map[string]interface{}) map[string]interface{} {
+		req := logical.TestRequest(t, logical.CreateOperation, "accounts/"+address+"/"+path)
+		req.Storage = storage
+		req.Data = data
+		res, err := b.HandleRequest(context.Background(), req)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		return res.Data
+	}
+	raw := single("signRaw", map[string]interface{}{
+		"payload":  "0x4fb2c4ad8c3e2a3ea9d16bd0e2e6aefa4b6d8df8a47f4fc5a1e6d1a0fb5b02c2",
+		"encoding": "der",
+	})
+	hashed := single("signRaw", map[string]interface{}{
+		"payload": "0x616263",
+		"hash":    "sha256",
+	})
+	message := single("sign-message", map[string]interface{}{
+		"message": "hello world",
+	})
+	tx := single("sign", map[string]interface{}{
+		"to":       "0xf809410b0d6f047c603deb311979cd413e025a84",
+		"data":     "0x",
+		"value":    "1000000000000000000000",
+		"nonce":    "7",
+		"gasPrice": "20000000000",
+		"chainId":  "1337",
+	})
+	dynamicFeeTx := single("sign", map[string]interface{}{
+		"to":                   "0xf809410b0d6f047c603deb311979cd413e025a84",
+		"data":                 "0x",
+		"nonce":                "8",
+		"gas":                  "21000",
+		"type":                 "2",
+		"maxFeePerGas":         "100",
+		"maxPriorityFeePerGas": "1",
+		"chainId":              "1",
+	})
+
+	req := logical.TestRequest(t, logical.CreateOperation, "accounts/"+address+"/sign-batch")
+	req.Storage = storage
+	req.Data = map[string]interface{}{
+		"items": `[
+			{"type": "raw", "payload": "0x4fb2c4ad8c3e2a3ea9d16bd0e2e6aefa4b6d8df8a47f4fc5a1e6d1a0fb5b02c2", "encoding": "der"},
+			{"type": "raw", "payload": "0x616263", "hash": "sha256"},
+			{"type": "message", "message": "hello world"},
+			{"type": "transaction", "to": "0xf809410b0d6f047c603deb311979cd413e025a84", "data": "0x", "value": 1000000000000000000000, "nonce": 7, "gasPrice": "20000000000", "chainId": 1337},
+			{"type": "raw", "payload": "0xabc"},
+			{"type": "raw", "payload": "0x616263"},
+			{"type": "xml"},
+			{"type": "message", "message": "hello", "payload": "0x00"},
+			{"type": "transaction", "txType": 2, "to": "0xf809410b0d6f047c603deb311979cd413e025a84", "data": "0x", "nonce": 8, "gas": 21000, "maxFeePerGas": "100", "maxPriorityFeePerGas": "1", "chainId": 1},
+			{"type": "message", "message": "hello", "txType": 2},
+			{"type": "transaction", "to": "0xf809410b0d6f047c603deb311979cd413e025a84", "data": "0x", "nonce": "0xzz", "gasPrice": "20000000000", "chainId": 1337}
+		]`,
+	}
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	results := res.Data["results"].([]map[string]interface{})
+	assert.Equal(11, len(results))
+	assert.Equal(raw, results[0])
+	assert.Equal(hashed, results[1])
+	assert.Equal(message, results[2])
+	assert.Equal(tx, results[3])
+	assert.Equal("hex string of odd length", results[4]["error"])
+	assert.Equal("'payload' must be a 32-byte digest when 'hash' is none, got 3 bytes", results[5]["error"])
+	assert.Equal("Unsupported item type xml", results[6]["error"])
+	assert.True(strings.HasPrefix(results[7]["error"].(string), "Invalid item: "))
+	// 'txType' is the 'type' of the transaction, only transaction items take it
+	assert.Equal(dynamicFeeTx, results[8])
+	assert.True(strings.HasPrefix(results[8]["signed_transaction"].(string), "0x02"))
+	assert.True(strings.HasPrefix(results[9]["error"].(string), "Invalid item: "))
+	// a malformed number fails its own item only
+	assert.Equal("Invalid 'nonce' value", results[10]["error"])
+
+	req.Data["items"] = "[]"
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.Equal("'items' must be a non-empty JSON array", err.Error())
+
+	req.Data["items"] = "{}"
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.True(strings.HasPrefix(err.Error(), "Invalid 'items' value: "))
+
+	// transaction items need an Ethereum account, as the sign endpoint does
+	res, err = createAccountWithType(t, b, storage, "ec85999367d32fbbe02dd600a2a44550b95274cc67d14375a9f0bce233f13ad2", "P2WPKH")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req = logical.TestRequest(t, logical.CreateOperation, "accounts/"+res.Data["address"].(string)+"/sign-batch")
+	req.Storage = storage
+	req.Data = map[string]interface{}{
+		"items": `[
+			{"type": "transaction", "to": "0xf809410b0d6f047c603deb311979cd413e025a84", "data": "0x", "nonce": 7, "gasPrice": "20000000000", "chainId": 1337},
+			{"type": "raw", "payload": "0x616263", "hash": "sha256"}
+		]`,
+	}
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	results = res.Data["results"].([]map[string]interface{})
+	assert.Equal("Items of type transaction can only be signed by accounts with an Ethereum address", results[0]["error"])
+	assert.NotEmpty(results[1]["signature"])
+}
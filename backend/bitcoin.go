@@ -0,0 +1,499 @@
+// Copyright © 2020 Kaleido
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// sigHashForkID marks Bitcoin Cash signatures, whose hash follows BIP-143 for all inputs
+const sigHashForkID txscript.SigHashType = 0x40
+
+// bitcoinSigner is the account key in the forms needed to recognise and sign Bitcoin inputs
+type bitcoinSigner struct {
+	key          *btcec.PrivateKey
+	compressed   []byte
+	uncompressed []byte
+	// forkID is set for Bitcoin Cash accounts, which always sign with SIGHASH_FORKID
+	forkID bool
+}
+
+func newBitcoinSigner(key *btcec.PrivateKey, addressType string) *bitcoinSigner {
+	return &bitcoinSigner{
+		key:          key,
+		compressed:   key.PubKey().SerializeCompressed(),
+		uncompressed: key.PubKey().SerializeUncompressed(),
+		forkID:       addressType == AddressTypeBCH,
+	}
+}
+
+func (b *backend) signPsbt(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	from := data.Get("name").(string)
+
+	packet, err := psbt.NewFromRawBytes(strings.NewReader(data.Get("psbt").(string)), true)
+	if err != nil {
+		b.Logger().Error("Failed to decode the PSBT", "error", err)
+		return nil, fmt.Errorf("Invalid 'psbt' value: %v", err)
+	}
+
+	account, err := b.retrieveAccountRaw(ctx, req, from)
+	if err != nil {
+		b.Logger().Error("Failed to retrieve the signing account", "address", from, "error", err)
+		return nil, fmt.Errorf("Error retrieving signing account %s", from)
+	}
+	if account == nil {
+		return nil, fmt.Errorf("Signing account %s does not exist", from)
+	}
+
+	privateKey, err := b.retrievePrivateKey(ctx, req, account)
+	if err != nil {
+		return nil, err
+	}
+	defer ZeroKey(privateKey)
+	key := toBtcecKey(privateKey)
+	defer key.Zero()
+
+	signed, err := signPsbtInputs(packet, newBitcoinSigner(key, account.AddressType))
+	if err != nil {
+		b.Logger().Error("Failed to sign the PSBT", "error", err)
+		return nil, err
+	}
+	if len(signed) == 0 {
+		return nil, fmt.Errorf("No input of the PSBT can be signed by account %s", from)
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"signedInputs": signed,
+		},
+	}
+	if data.Get("finalize").(bool) {
+		if err := psbt.MaybeFinalizeAll(packet); err != nil {
+			b.Logger().Error("Failed to finalize the PSBT", "error", err)
+			return nil, fmt.Errorf("Failed to finalize the PSBT: %v", err)
+		}
+		tx, err := psbt.Extract(packet)
+		if err != nil {
+			b.Logger().Error("Failed to extract the signed transaction", "error", err)
+			return nil, fmt.Errorf("Failed to extract the signed transaction: %v", err)
+		}
+		var buf bytes.Buffer
+		if err := tx.Serialize(&buf); err != nil {
+			return nil, err
+		}
+		resp.Data["signed_transaction"] = hex.EncodeToString(buf.Bytes())
+		resp.Data["transaction_hash"] = tx.TxHash().String()
+	}
+
+	encoded, err := packet.B64Encode()
+	if err != nil {
+		b.Logger().Error("Failed to encode the PSBT", "error", err)
+		return nil, err
+	}
+	resp.Data["psbt"] = encoded
+	resp.Data["complete"] = packet.IsComplete()
+	return resp, nil
+}
+
+func (b *backend) signInput(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	from := data.Get("name").(string)
+
+	rawTx, err := hex.DecodeString(strings.TrimPrefix(data.Get("transaction").(string), "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid 'transaction' value: %v", err)
+	}
+	var tx wire.MsgTx
+	if err := tx.Deserialize(bytes.NewReader(rawTx)); err != nil {
+		b.Logger().Error("Failed to decode the transaction", "error", err)
+		return nil, fmt.Errorf("Invalid 'transaction' value: %v", err)
+	}
+	index := data.Get("inputIndex").(int)
+	if index < 0 || index >= len(tx.TxIn) {
+		return nil, fmt.Errorf("'inputIndex' %d is out of range, the transaction has %d inputs", index, len(tx.TxIn))
+	}
+	scripts := map[string][]byte{}
+	for _, field := range []string{"prevScript", "redeemScript", "witnessScript"} {
+		if value := data.Get(field).(string); value != "" {
+			script, err := hex.DecodeString(strings.TrimPrefix(value, "0x"))
+			if err != nil {
+				return nil, fmt.Errorf("Invalid '%s' value: %v", field, err)
+			}
+			scripts[field] = script
+		}
+	}
+	if scripts["prevScript"] == nil {
+		return nil, fmt.Errorf("'prevScript' is required")
+	}
+	if txscript.IsPayToTaproot(scripts["prevScript"]) {
+		return nil, fmt.Errorf("Taproot inputs must be signed with the sign-psbt endpoint")
+	}
+	hashType, err := parseSigHashType(data.Get("sighashType").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := b.retrieveAccountRaw(ctx, req, from)
+	if err != nil {
+		b.Logger().Error("Failed to retrieve the signing account", "address", from, "error", err)
+		return nil, fmt.Errorf("Error retrieving signing account %s", from)
+	}
+	if account == nil {
+		return nil, fmt.Errorf("Signing account %s does not exist", from)
+	}
+
+	privateKey, err := b.retrievePrivateKey(ctx, req, account)
+	if err != nil {
+		return nil, err
+	}
+	defer ZeroKey(privateKey)
+	key := toBtcecKey(privateKey)
+	defer key.Zero()
+	signer := newBitcoinSigner(key, account.AddressType)
+
+	spend := signer.resolveECDSASpend(scripts["prevScript"], scripts["redeemScript"], scripts["witnessScript"], scriptPushesKey)
+	if spend == nil {
+		return nil, fmt.Errorf("'prevScript' does not pay to account %s", from)
+	}
+	if signer.forkID {
+		hashType |= sigHashForkID
+	}
+	var amount int64
+	if spend.segwit || signer.forkID {
+		amount, err = strconv.ParseInt(data.Get("amount").(string), 10, 64)
+		if err != nil || amount < 0 {
+			if signer.forkID {
+				return nil, fmt.Errorf("Bitcoin Cash inputs require the 'amount' of the previous output in satoshis")
+			}
+			return nil, fmt.Errorf("Segwit inputs require the 'amount' of the previous output in satoshis")
+		}
+	}
+	sigHashes := txscript.NewTxSigHashes(&tx, txscript.NewCannedPrevOutputFetcher(scripts["prevScript"], amount))
+	sigHash, err := spend.sigHash(&tx, index, amount, hashType, sigHashes)
+	if err != nil {
+		b.Logger().Error("Failed to compute the signature hash", "error", err)
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"signature": hex.EncodeToString(ecdsaSignatureWithHashType(key, sigHash, hashType)),
+			"sighash":   hex.EncodeToString(sigHash),
+			"publicKey": hex.EncodeToString(spend.pubKey),
+		},
+	}, nil
+}
+
+// signPsbtInputs adds a signature to every input of the packet that spends an output of the
+// signer's key, and returns the indexes of the signed inputs
+func signPsbtInputs(packet *psbt.Packet, signer *bitcoinSigner) ([]int, error) {
+	tx := packet.UnsignedTx
+	prevOuts := make(map[wire.OutPoint]*wire.TxOut, len(tx.TxIn))
+	allPrevOuts := true
+	for i, txIn := range tx.TxIn {
+		prevOut, err := psbtPrevOut(packet, i)
+		if err != nil {
+			return nil, err
+		}
+		if prevOut == nil {
+			// only taproot signature hashes commit to all the spent outputs
+			allPrevOuts = false
+			prevOut = wire.NewTxOut(0, nil)
+		}
+		prevOuts[txIn.PreviousOutPoint] = prevOut
+	}
+	fetcher := txscript.NewMultiPrevOutFetcher(prevOuts)
+	sigHashes := txscript.NewTxSigHashes(tx, fetcher)
+
+	updater, err := psbt.NewUpdater(packet)
+	if err != nil {
+		return nil, err
+	}
+
+	signed := []int{}
+	for i := range tx.TxIn {
+		input := &packet.Inputs[i]
+		if input.FinalScriptSig != nil || input.FinalScriptWitness != nil {
+			continue
+		}
+		prevOut := prevOuts[tx.TxIn[i].PreviousOutPoint]
+		if len(prevOut.PkScript) == 0 {
+			continue
+		}
+
+		if txscript.IsPayToTaproot(prevOut.PkScript) {
+			ok, err := signTaprootInput(input, i, prevOut, sigHashes, fetcher, tx, signer)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to sign input %d: %v", i, err)
+			}
+			if ok {
+				if !allPrevOuts {
+					return nil, fmt.Errorf("Failed to sign input %d: taproot inputs require the previous outputs of all inputs", i)
+				}
+				signed = append(signed, i)
+			}
+			continue
+		}
+
+		ok, err := signECDSAInput(updater, input, i, prevOut, sigHashes, tx, signer)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to sign input %d: %v", i, err)
+		}
+		if ok {
+			signed = append(signed, i)
+		}
+	}
+	return signed, nil
+}
+
+// psbtPrevOut returns the output spent by the input, nil if the PSBT does not carry it
+func psbtPrevOut(packet *psbt.Packet, index int) (*wire.TxOut, error) {
+	input := packet.Inputs[index]
+	if input.WitnessUtxo != nil {
+		return input.WitnessUtxo, nil
+	}
+	if input.NonWitnessUtxo != nil {
+		outPoint := packet.UnsignedTx.TxIn[index].PreviousOutPoint
+		if input.NonWitnessUtxo.TxHash() != outPoint.Hash || int(outPoint.Index) >= len(input.NonWitnessUtxo.TxOut) {
+			return nil, fmt.Errorf("Previous transaction of input %d does not match its outpoint", index)
+		}
+		return input.NonWitnessUtxo.TxOut[outPoint.Index], nil
+	}
+	return nil, nil
+}
+
+// signECDSAInput signs legacy and segwit v0 inputs paying to the signer's key
+func signECDSAInput(updater *psbt.Updater, input *psbt.PInput, index int, prevOut *wire.TxOut,
+	sigHashes *txscript.TxSigHashes, tx *wire.MsgTx, signer *bitcoinSigner) (bool, error) {
+
+	listsKey := func(script []byte, pubKey []byte) bool {
+		for _, derivation := range input.Bip32Derivation {
+			if bytes.Equal(derivation.PubKey, pubKey) {
+				return true
+			}
+		}
+		return scriptPushesKey(script, pubKey)
+	}
+	spend := signer.resolveECDSASpend(prevOut.PkScript, input.RedeemScript, input.WitnessScript, listsKey)
+	if spend == nil {
+		return false, nil
+	}
+	for _, partialSig := range input.PartialSigs {
+		if bytes.Equal(partialSig.PubKey, spend.pubKey) {
+			// already signed by this key
+			return false, nil
+		}
+	}
+
+	hashType := input.SighashType
+	if hashType == 0 {
+		hashType = txscript.SigHashAll
+	}
+	if signer.forkID {
+		hashType |= sigHashForkID
+	}
+	sigHash, err := spend.sigHash(tx, index, prevOut.Value, hashType, sigHashes)
+	if err != nil {
+		return false, err
+	}
+
+	var psbtRedeemScript []byte
+	if input.RedeemScript == nil {
+		psbtRedeemScript = spend.redeemScript
+	}
+	sig := ecdsaSignatureWithHashType(signer.key, sigHash, hashType)
+	if _, err := updater.Sign(index, sig, spend.pubKey, psbtRedeemScript, nil); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ecdsaSpend is how an output of the signer's key is spent with an ECDSA signature
+type ecdsaSpend struct {
+	pubKey       []byte
+	scriptCode   []byte
+	redeemScript []byte
+	segwit       bool
+}
+
+// resolveECDSASpend works out the public key and script code needed to spend the output script,
+// either directly (P2PKH, P2WPKH, P2SH-P2WPKH) or through a redeem or witness script for which
+// listsKey reports the key. It returns nil if the output does not pay to the signer.
+func (s *bitcoinSigner) resolveECDSASpend(pkScript, redeemScript, witnessScript []byte,
+	listsKey func(script []byte, pubKey []byte) bool) *ecdsaSpend {
+
+	spend := &ecdsaSpend{}
+	if txscript.IsPayToScriptHash(pkScript) {
+		if redeemScript == nil {
+			// a nested P2WPKH output of the signer needs no explicit redeem script
+			redeemScript = payToWitnessPubKeyHashScript(s.compressed)
+		}
+		if !bytes.Equal(pkScript[2:22], btcutil.Hash160(redeemScript)) {
+			return nil
+		}
+		spend.redeemScript = redeemScript
+		pkScript = redeemScript
+	}
+
+	spend.segwit = txscript.IsWitnessProgram(pkScript)
+	switch {
+	case txscript.IsPayToWitnessPubKeyHash(pkScript):
+		if !bytes.Equal(pkScript[2:], btcutil.Hash160(s.compressed)) {
+			return nil
+		}
+		spend.pubKey = s.compressed
+		spend.scriptCode = payToPubKeyHashScript(s.compressed)
+	case txscript.IsPayToWitnessScriptHash(pkScript):
+		witnessScriptHash := sha256.Sum256(witnessScript)
+		if witnessScript == nil || !bytes.Equal(pkScript[2:], witnessScriptHash[:]) || !listsKey(witnessScript, s.compressed) {
+			return nil
+		}
+		spend.pubKey = s.compressed
+		spend.scriptCode = witnessScript
+	case txscript.IsPayToPubKeyHash(pkScript):
+		switch hash := pkScript[3:23]; {
+		case bytes.Equal(hash, btcutil.Hash160(s.uncompressed)):
+			spend.pubKey = s.uncompressed
+		case bytes.Equal(hash, btcutil.Hash160(s.compressed)):
+			spend.pubKey = s.compressed
+		default:
+			return nil
+		}
+		spend.scriptCode = pkScript
+	case spend.redeemScript != nil && !spend.segwit:
+		// legacy P2SH, e.g. bare multisig
+		switch {
+		case listsKey(redeemScript, s.compressed):
+			spend.pubKey = s.compressed
+		case listsKey(redeemScript, s.uncompressed):
+			spend.pubKey = s.uncompressed
+		default:
+			return nil
+		}
+		spend.scriptCode = redeemScript
+	default:
+		return nil
+	}
+	return spend
+}
+
+// sigHash computes the legacy or BIP-143 signature hash of the input. Bitcoin Cash uses the
+// BIP-143 hash for legacy inputs too, with the SIGHASH_FORKID flag and a fork id of 0.
+func (spend *ecdsaSpend) sigHash(tx *wire.MsgTx, index int, amount int64, hashType txscript.SigHashType,
+	sigHashes *txscript.TxSigHashes) ([]byte, error) {
+
+	if spend.segwit || hashType&sigHashForkID != 0 {
+		return txscript.CalcWitnessSigHash(spend.scriptCode, sigHashes, hashType, tx, index, amount)
+	}
+	return txscript.CalcSignatureHash(spend.scriptCode, hashType, tx, index)
+}
+
+// signTaprootInput produces the key-path signature of taproot outputs of the signer's key,
+// tweaked with the merkle root of the script tree when the PSBT provides one
+func signTaprootInput(input *psbt.PInput, index int, prevOut *wire.TxOut, sigHashes *txscript.TxSigHashes,
+	fetcher txscript.PrevOutputFetcher, tx *wire.MsgTx, signer *bitcoinSigner) (bool, error) {
+
+	if input.TaprootKeySpendSig != nil {
+		return false, nil
+	}
+	outputKey := txscript.ComputeTaprootOutputKey(signer.key.PubKey(), input.TaprootMerkleRoot)
+	if !bytes.Equal(prevOut.PkScript[2:], schnorr.SerializePubKey(outputKey)) {
+		return false, nil
+	}
+
+	hashType := input.SighashType
+	sigHash, err := txscript.CalcTaprootSignatureHash(sigHashes, hashType, tx, index, fetcher)
+	if err != nil {
+		return false, err
+	}
+	tweakedKey := txscript.TweakTaprootPrivKey(signer.key, input.TaprootMerkleRoot)
+	defer tweakedKey.Zero()
+	sig, err := schnorr.Sign(tweakedKey, sigHash)
+	if err != nil {
+		return false, err
+	}
+	input.TaprootKeySpendSig = sig.Serialize()
+	if hashType != txscript.SigHashDefault {
+		input.TaprootKeySpendSig = append(input.TaprootKeySpendSig, byte(hashType))
+	}
+	if input.TaprootInternalKey == nil {
+		input.TaprootInternalKey = schnorr.SerializePubKey(signer.key.PubKey())
+	}
+	return true, nil
+}
+
+// scriptPushesKey tells whether the script pushes the public key, as multisig scripts do
+func scriptPushesKey(script []byte, pubKey []byte) bool {
+	push := append([]byte{byte(len(pubKey))}, pubKey...)
+	return bytes.Contains(script, push)
+}
+
+// parseSigHashType parses ALL, NONE and SINGLE, optionally combined with ANYONECANPAY as in
+// "ALL|ANYONECANPAY". The SIGHASH_ prefix is optional.
+func parseSigHashType(input string) (txscript.SigHashType, error) {
+	name := strings.ToUpper(strings.ReplaceAll(input, "SIGHASH_", ""))
+	var hashType txscript.SigHashType
+	if strings.HasSuffix(name, "|ANYONECANPAY") {
+		hashType = txscript.SigHashAnyOneCanPay
+		name = strings.TrimSuffix(name, "|ANYONECANPAY")
+	}
+	switch name {
+	case "ALL":
+		return hashType | txscript.SigHashAll, nil
+	case "NONE":
+		return hashType | txscript.SigHashNone, nil
+	case "SINGLE":
+		return hashType | txscript.SigHashSingle, nil
+	default:
+		return 0, fmt.Errorf("Unsupported 'sighashType' value %s", input)
+	}
+}
+
+// ecdsaSignatureWithHashType returns the DER encoded signature followed by the sighash type byte,
+// as expected by Bitcoin script
+func ecdsaSignatureWithHashType(key *btcec.PrivateKey, sigHash []byte, hashType txscript.SigHashType) []byte {
+	return append(ecdsa.Sign(key, sigHash).Serialize(), byte(hashType))
+}
+
+func payToPubKeyHashScript(pubKey []byte) []byte {
+	script, _ := txscript.NewScriptBuilder().
+		AddOp(txscript.OP_DUP).
+		AddOp(txscript.OP_HASH160).
+		AddData(btcutil.Hash160(pubKey)).
+		AddOp(txscript.OP_EQUALVERIFY).
+		AddOp(txscript.OP_CHECKSIG).
+		Script()
+	return script
+}
+
+// payToWitnessPubKeyHashScript returns witness version 0 followed by the 20-byte public key hash
+func payToWitnessPubKeyHashScript(pubKey []byte) []byte {
+	return append([]byte{txscript.OP_0, txscript.OP_DATA_20}, btcutil.Hash160(pubKey)...)
+}
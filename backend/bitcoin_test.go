@@ -0,0 +1,416 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	btcecdsa "github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignPsbt(t *testing.T) {
+	assert := assert.New(t)
+
+	b, storage := getBackend(t)
+
+	privateKey := "c9bdb49cfbaedca21c4b1f3a7803c34636b1d7dc55a717132443fc3f4c5867e8"
+	res, err := createAccountWithType(t, b, storage, privateKey, "P2WPKH")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	address := res.Data["address"].(string)
+
+	keyBytes, _ := hex.DecodeString(privateKey)
+	_, pub := btcec.PrivKeyFromBytes(keyBytes)
+	nestedScript := payToWitnessPubKeyHashScript(pub.SerializeCompressed())
+	p2sh, _ := txscript.NewScriptBuilder().AddOp(txscript.OP_HASH160).AddData(btcutil.Hash160(nestedScript)).AddOp(txscript.OP_EQUAL).Script()
+	p2tr, _ := txscript.NewScriptBuilder().AddOp(txscript.OP_1).AddData(schnorr.SerializePubKey(txscript.ComputeTaprootKeyNoScript(pub))).Script()
+
+	// one output of each kind paying to the account key
+	prevTx := wire.NewMsgTx(2)
+	prevTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{1}}, nil, nil))
+	prevTx.AddTxOut(wire.NewTxOut(10000, payToPubKeyHashScript(pub.SerializeUncompressed())))
+	prevTx.AddTxOut(wire.NewTxOut(20000, nestedScript))
+	prevTx.AddTxOut(wire.NewTxOut(30000, p2sh))
+	prevTx.AddTxOut(wire.NewTxOut(40000, p2tr))
+
+	tx := wire.NewMsgTx(2)
+	for i := range prevTx.TxOut {
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, uint32(i)), nil, nil))
+		tx.TxIn[i].PreviousOutPoint.Hash = prevTx.TxHash()
+	}
+	tx.AddTxOut(wire.NewTxOut(90000, nestedScript))
+
+	packet, _ := psbt.NewFromUnsignedTx(tx)
+	packet.Inputs[0].NonWitnessUtxo = prevTx
+	for i := 1; i < len(prevTx.TxOut); i++ {
+		packet.Inputs[i].WitnessUtxo = prevTx.TxOut[i]
+	}
+	encoded, _ := packet.B64Encode()
+
+	req := logical.TestRequest(t, logical.CreateOperation, "accounts/"+address+"/sign-psbt")
+	req.Storage = storage
+	req.Data = map[string]interface{}{
+		"psbt": encoded,
+	}
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	assert.Equal([]int{0, 1, 2, 3}, res.Data["signedInputs"].([]int))
+	assert.False(res.Data["complete"].(bool))
+	assert.Nil(res.Data["signed_transaction"])
+
+	// signing the signed PSBT again has nothing left to do
+	req.Data["psbt"] = res.Data["psbt"].(string)
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.Equal("No input of the PSBT can be signed by account "+address, err.Error())
+
+	req.Data = map[string]interface{}{
+		"psbt":     encoded,
+		"finalize": true,
+	}
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	rawTx, _ := hex.DecodeString(res.Data["signed_transaction"].(string))
+	var signedTx wire.MsgTx
+	if err := signedTx.Deserialize(bytes.NewReader(rawTx)); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	assert.Equal(signedTx.TxHash().String(), res.Data["transaction_hash"].(string))
+	assert.True(res.Data["complete"].(bool))
+
+	// every input must pass script validation
+	prevOuts := txscript.NewMultiPrevOutFetcher(nil)
+	for i, txOut := range prevTx.TxOut {
+		prevOuts.AddPrevOut(signedTx.TxIn[i].PreviousOutPoint, txOut)
+	}
+	sigHashes := txscript.NewTxSigHashes(&signedTx, prevOuts)
+	for i, txOut := range prevTx.TxOut {
+		vm, err := txscript.NewEngine(txOut.PkScript, &signedTx, i, txscript.StandardVerifyFlags, nil, sigHashes, txOut.Value, prevOuts)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		assert.NoError(vm.Execute(), "input %d", i)
+	}
+
+	// SIGHASH_DEFAULT key-path signatures have no sighash type byte
+	assert.Equal(64, len(signedTx.TxIn[3].Witness[0]))
+
+	// a PSBT not spending the account's outputs
+	other := wire.NewMsgTx(2)
+	other.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{2}, 0), nil, nil))
+	other.AddTxOut(wire.NewTxOut(1000, nestedScript))
+	otherPacket, _ := psbt.NewFromUnsignedTx(other)
+	otherPacket.Inputs[0].WitnessUtxo = wire.NewTxOut(2000, payToWitnessPubKeyHashScript(make([]byte, 33)))
+	encoded, _ = otherPacket.B64Encode()
+	req.Data = map[string]interface{}{
+		"psbt": encoded,
+	}
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.Equal("No input of the PSBT can be signed by account "+address, err.Error())
+
+	// finalizing fails while other inputs are unsigned
+	req.Data["finalize"] = true
+	other.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{3}, 0), nil, nil))
+	otherPacket, _ = psbt.NewFromUnsignedTx(other)
+	otherPacket.Inputs[0].WitnessUtxo = prevTx.TxOut[1]
+	otherPacket.Inputs[1].WitnessUtxo = wire.NewTxOut(2000, payToWitnessPubKeyHashScript(make([]byte, 33)))
+	req.Data["psbt"], _ = otherPacket.B64Encode()
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.True(strings.HasPrefix(err.Error(), "Failed to finalize the PSBT: "))
+
+	req.Data["psbt"] = "cHNidP8="
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.True(strings.HasPrefix(err.Error(), "Invalid 'psbt' value: "))
+}
+
+func TestSignInput(t *testing.T) {
+	assert := assert.New(t)
+
+	b, storage := getBackend(t)
+
+	privateKey := "c9bdb49cfbaedca21c4b1f3a7803c34636b1d7dc55a717132443fc3f4c5867e8"
+	res, err := createAccountWithType(t, b, storage, privateKey, "P2SH-P2WPKH")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	address := res.Data["address"].(string)
+
+	keyBytes, _ := hex.DecodeString(privateKey)
+	_, pub := btcec.PrivKeyFromBytes(keyBytes)
+	nestedScript := payToWitnessPubKeyHashScript(pub.SerializeCompressed())
+	p2sh, _ := txscript.NewScriptBuilder().AddOp(txscript.OP_HASH160).AddData(btcutil.Hash160(nestedScript)).AddOp(txscript.OP_EQUAL).Script()
+	prevOuts := []*wire.TxOut{
+		wire.NewTxOut(10000, payToPubKeyHashScript(pub.SerializeUncompressed())),
+		wire.NewTxOut(20000, nestedScript),
+		wire.NewTxOut(30000, p2sh),
+	}
+
+	tx := wire.NewMsgTx(2)
+	fetcher := txscript.NewMultiPrevOutFetcher(nil)
+	for i, prevOut := range prevOuts {
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{byte(i + 1)}, 0), nil, nil))
+		fetcher.AddPrevOut(tx.TxIn[i].PreviousOutPoint, prevOut)
+	}
+	tx.AddTxOut(wire.NewTxOut(50000, nestedScript))
+	var buf bytes.Buffer
+	_ = tx.Serialize(&buf)
+
+	req := logical.TestRequest(t, logical.CreateOperation, "accounts/"+address+"/sign-input")
+	req.Storage = storage
+	sighashTypes := []string{"ALL", "NONE|ANYONECANPAY", "SIGHASH_SINGLE"}
+	for i, prevOut := range prevOuts {
+		req.Data = map[string]interface{}{
+			"transaction": hex.EncodeToString(buf.Bytes()),
+			"inputIndex":  i,
+			"prevScript":  hex.EncodeToString(prevOut.PkScript),
+			"amount":      strconv.FormatInt(prevOut.Value, 10),
+			"sighashType": sighashTypes[i],
+		}
+		res, err = b.HandleRequest(context.Background(), req)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		sig, _ := hex.DecodeString(res.Data["signature"].(string))
+		pubKey, _ := hex.DecodeString(res.Data["publicKey"].(string))
+		switch i {
+		case 0:
+			assert.Equal(byte(txscript.SigHashAll), sig[len(sig)-1])
+			assert.Equal(pub.SerializeUncompressed(), pubKey)
+			tx.TxIn[i].SignatureScript, _ = txscript.NewScriptBuilder().AddData(sig).AddData(pubKey).Script()
+		case 1:
+			assert.Equal(byte(txscript.SigHashNone|txscript.SigHashAnyOneCanPay), sig[len(sig)-1])
+			tx.TxIn[i].Witness = wire.TxWitness{sig, pubKey}
+		case 2:
+			assert.Equal(byte(txscript.SigHashSingle), sig[len(sig)-1])
+			tx.TxIn[i].SignatureScript, _ = txscript.NewScriptBuilder().AddData(nestedScript).Script()
+			tx.TxIn[i].Witness = wire.TxWitness{sig, pubKey}
+		}
+	}
+
+	sigHashes := txscript.NewTxSigHashes(tx, fetcher)
+	for i, prevOut := range prevOuts {
+		vm, err := txscript.NewEngine(prevOut.PkScript, tx, i, txscript.StandardVerifyFlags, nil, sigHashes, prevOut.Value, fetcher)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		assert.NoError(vm.Execute(), "input %d", i)
+	}
+
+	req.Data = map[string]interface{}{
+		"transaction": hex.EncodeToString(buf.Bytes()),
+		"inputIndex":  1,
+		"prevScript":  hex.EncodeToString(nestedScript),
+	}
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.Equal("Segwit inputs require the 'amount' of the previous output in satoshis", err.Error())
+
+	req.Data["sighashType"] = "ALL|NONE"
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.Equal("Unsupported 'sighashType' value ALL|NONE", err.Error())
+
+	req.Data = map[string]interface{}{
+		"transaction": hex.EncodeToString(buf.Bytes()),
+		"inputIndex":  3,
+		"prevScript":  hex.EncodeToString(nestedScript),
+	}
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.Equal("'inputIndex' 3 is out of range, the transaction has 3 inputs", err.Error())
+
+	req.Data["inputIndex"] = 0
+	req.Data["prevScript"] = hex.EncodeToString(payToWitnessPubKeyHashScript(make([]byte, 33)))
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.Equal("'prevScript' does not pay to account "+address, err.Error())
+}
+
+func TestSignLitecoinDogecoin(t *testing.T) {
+	assert := assert.New(t)
+
+	b, storage := getBackend(t)
+
+	privateKey := "c9bdb49cfbaedca21c4b1f3a7803c34636b1d7dc55a717132443fc3f4c5867e8"
+	keyBytes, _ := hex.DecodeString(privateKey)
+	_, pub := btcec.PrivKeyFromBytes(keyBytes)
+	addresses := map[string]string{}
+	for _, addressType := range []string{"LTC-P2WPKH", "DOGE-P2PKH"} {
+		res, err := createAccountWithType(t, b, storage, privateKey, addressType)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		addresses[addressType] = res.Data["address"].(string)
+	}
+
+	// the networks share the Bitcoin scripts and signature hashes
+	prevTx := wire.NewMsgTx(2)
+	prevTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{1}}, nil, nil))
+	prevTx.AddTxOut(wire.NewTxOut(10000, payToWitnessPubKeyHashScript(pub.SerializeCompressed())))
+	prevTx.AddTxOut(wire.NewTxOut(20000, payToPubKeyHashScript(pub.SerializeCompressed())))
+	dogeAddress, _ := btcutil.NewAddressPubKeyHash(btcutil.Hash160(pub.SerializeCompressed()), &dogecoinMainNetParams)
+	assert.Equal(dogeAddress.EncodeAddress(), addresses["DOGE-P2PKH"])
+
+	tx := wire.NewMsgTx(2)
+	fetcher := txscript.NewMultiPrevOutFetcher(nil)
+	for i, prevOut := range prevTx.TxOut {
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, uint32(i)), nil, nil))
+		tx.TxIn[i].PreviousOutPoint.Hash = prevTx.TxHash()
+		fetcher.AddPrevOut(tx.TxIn[i].PreviousOutPoint, prevOut)
+	}
+	tx.AddTxOut(wire.NewTxOut(25000, prevTx.TxOut[0].PkScript))
+	validate := func(signedTx *wire.MsgTx) {
+		sigHashes := txscript.NewTxSigHashes(signedTx, fetcher)
+		for i, prevOut := range prevTx.TxOut {
+			vm, err := txscript.NewEngine(prevOut.PkScript, signedTx, i, txscript.StandardVerifyFlags, nil, sigHashes, prevOut.Value, fetcher)
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			assert.NoError(vm.Execute(), "input %d", i)
+		}
+	}
+
+	packet, _ := psbt.NewFromUnsignedTx(tx)
+	packet.Inputs[0].WitnessUtxo = prevTx.TxOut[0]
+	packet.Inputs[1].NonWitnessUtxo = prevTx
+	encoded, _ := packet.B64Encode()
+	req := logical.TestRequest(t, logical.CreateOperation, "accounts/"+addresses["LTC-P2WPKH"]+"/sign-psbt")
+	req.Storage = storage
+	req.Data = map[string]interface{}{
+		"psbt":     encoded,
+		"finalize": true,
+	}
+	res, err := b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	assert.Equal([]int{0, 1}, res.Data["signedInputs"].([]int))
+	rawTx, _ := hex.DecodeString(res.Data["signed_transaction"].(string))
+	var signedTx wire.MsgTx
+	if err := signedTx.Deserialize(bytes.NewReader(rawTx)); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	validate(&signedTx)
+
+	// the legacy input signed on its own by the Dogecoin account
+	req = logical.TestRequest(t, logical.CreateOperation, "accounts/"+addresses["DOGE-P2PKH"]+"/sign-input")
+	req.Storage = storage
+	var buf bytes.Buffer
+	_ = tx.Serialize(&buf)
+	req.Data = map[string]interface{}{
+		"transaction": hex.EncodeToString(buf.Bytes()),
+		"inputIndex":  1,
+		"prevScript":  hex.EncodeToString(prevTx.TxOut[1].PkScript),
+	}
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	sig, _ := hex.DecodeString(res.Data["signature"].(string))
+	pubKey, _ := hex.DecodeString(res.Data["publicKey"].(string))
+	signedTx.TxIn[1].SignatureScript, _ = txscript.NewScriptBuilder().AddData(sig).AddData(pubKey).Script()
+	validate(&signedTx)
+}
+
+func TestSignBitcoinCash(t *testing.T) {
+	assert := assert.New(t)
+
+	b, storage := getBackend(t)
+
+	privateKey := "c9bdb49cfbaedca21c4b1f3a7803c34636b1d7dc55a717132443fc3f4c5867e8"
+	keyBytes, _ := hex.DecodeString(privateKey)
+	_, pub := btcec.PrivKeyFromBytes(keyBytes)
+	res, err := createAccountWithType(t, b, storage, privateKey, "BCH")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	address := res.Data["address"].(string)
+
+	prevTx := wire.NewMsgTx(2)
+	prevTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{1}}, nil, nil))
+	prevTx.AddTxOut(wire.NewTxOut(50000, payToPubKeyHashScript(pub.SerializeCompressed())))
+	prevOut := prevTx.TxOut[0]
+
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, 0), nil, nil))
+	tx.TxIn[0].PreviousOutPoint.Hash = prevTx.TxHash()
+	tx.AddTxOut(wire.NewTxOut(40000, prevOut.PkScript))
+	var buf bytes.Buffer
+	_ = tx.Serialize(&buf)
+
+	// the signature hash is the BIP-143 one with SIGHASH_ALL|SIGHASH_FORKID, even for P2PKH
+	sigHashes := txscript.NewTxSigHashes(tx, txscript.NewCannedPrevOutputFetcher(prevOut.PkScript, prevOut.Value))
+	expectedHash, _ := txscript.CalcWitnessSigHash(prevOut.PkScript, sigHashes, txscript.SigHashAll|sigHashForkID, tx, 0, prevOut.Value)
+	verify := func(sig []byte) {
+		assert.Equal(byte(0x41), sig[len(sig)-1])
+		parsed, err := btcecdsa.ParseDERSignature(sig[:len(sig)-1])
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		assert.True(parsed.Verify(expectedHash, pub))
+	}
+
+	req := logical.TestRequest(t, logical.CreateOperation, "accounts/"+address+"/sign-input")
+	req.Storage = storage
+	req.Data = map[string]interface{}{
+		"transaction": hex.EncodeToString(buf.Bytes()),
+		"prevScript":  hex.EncodeToString(prevOut.PkScript),
+		"amount":      "50000",
+	}
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	assert.Equal(hex.EncodeToString(expectedHash), res.Data["sighash"].(string))
+	sig, _ := hex.DecodeString(res.Data["signature"].(string))
+	verify(sig)
+
+	delete(req.Data, "amount")
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.Equal("Bitcoin Cash inputs require the 'amount' of the previous output in satoshis", err.Error())
+
+	packet, _ := psbt.NewFromUnsignedTx(tx)
+	packet.Inputs[0].NonWitnessUtxo = prevTx
+	encoded, _ := packet.B64Encode()
+	req = logical.TestRequest(t, logical.CreateOperation, "accounts/"+address+"/sign-psbt")
+	req.Storage = storage
+	req.Data = map[string]interface{}{
+		"psbt": encoded,
+	}
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	packet, _ = psbt.NewFromRawBytes(strings.NewReader(res.Data["psbt"].(string)), true)
+	verify(packet.Inputs[0].PartialSigs[0].Signature)
+
+	// other accounts of the same key keep the legacy signature hash
+	res, err = createAccountWithType(t, b, storage, privateKey, "P2PKH")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req = logical.TestRequest(t, logical.CreateOperation, "accounts/"+res.Data["address"].(string)+"/sign-input")
+	req.Storage = storage
+	req.Data = map[string]interface{}{
+		"transaction": hex.EncodeToString(buf.Bytes()),
+		"prevScript":  hex.EncodeToString(prevOut.PkScript),
+	}
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	legacyHash, _ := txscript.CalcSignatureHash(prevOut.PkScript, txscript.SigHashAll, tx, 0)
+	assert.Equal(hex.EncodeToString(legacyHash), res.Data["sighash"].(string))
+}
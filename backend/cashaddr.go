@@ -0,0 +1,68 @@
+// Copyright © 2020 Kaleido
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil/bech32"
+)
+
+// cashAddrP2PKH is the CashAddr version byte of 160-bit public key hashes
+const cashAddrP2PKH byte = 0x00
+
+// bitcoinCashPrefix is the CashAddr prefix of the Bitcoin Cash main network
+const bitcoinCashPrefix = "bitcoincash"
+
+const cashAddrCharset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// encodeCashAddr encodes the hash with the version byte as a CashAddr, without the prefix. The
+// payload is in base32 like bech32, with a 40-bit BCH checksum covering the prefix.
+func encodeCashAddr(prefix string, version byte, hash []byte) string {
+	payload, _ := bech32.ConvertBits(append([]byte{version}, hash...), 8, 5, true)
+
+	values := make([]byte, 0, len(prefix)+1+len(payload)+8)
+	for _, c := range []byte(prefix) {
+		values = append(values, c&0x1f)
+	}
+	values = append(values, 0)
+	values = append(values, payload...)
+	values = append(values, make([]byte, 8)...)
+	checksum := cashAddrPolymod(values)
+
+	var sb strings.Builder
+	for _, v := range payload {
+		sb.WriteByte(cashAddrCharset[v])
+	}
+	for i := 0; i < 8; i++ {
+		sb.WriteByte(cashAddrCharset[(checksum>>(5*(7-i)))&0x1f])
+	}
+	return sb.String()
+}
+
+func cashAddrPolymod(values []byte) uint64 {
+	generators := [5]uint64{0x98f2bc8e61, 0x79b76d99e2, 0xf33e5fb3c4, 0xae2eabe2a8, 0x1e4f43e470}
+	c := uint64(1)
+	for _, d := range values {
+		c0 := byte(c >> 35)
+		c = ((c & 0x07ffffffff) << 5) ^ uint64(d)
+		for i, g := range generators {
+			if c0&(1<<i) != 0 {
+				c ^= g
+			}
+		}
+	}
+	return c ^ 1
+}
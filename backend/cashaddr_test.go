@@ -0,0 +1,22 @@
+package backend
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeCashAddr(t *testing.T) {
+	assert := assert.New(t)
+
+	// examples of the CashAddr specification
+	for hash, expected := range map[string]string{
+		"76a04053bda0a88bda5177b86a15c3b29f559873": "qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a",
+		"cb481232299cd5743151ac4b2d63ae198e7bb0a9": "qr95sy3j9xwd2ap32xkykttr4cvcu7as4y0qverfuy",
+		"011f28e473c95f4013d7d53ec5fbc3b42df8ed10": "qqq3728yw0y47sqn6l2na30mcw6zm78dzqre909m2r",
+	} {
+		decoded, _ := hex.DecodeString(hash)
+		assert.Equal(expected, encodeCashAddr(bitcoinCashPrefix, cashAddrP2PKH, decoded))
+	}
+}
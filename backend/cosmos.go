@@ -0,0 +1,127 @@
+// Copyright © 2020 Kaleido
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// Cosmos SDK sign modes
+const (
+	// SignModeDirect signs the protobuf encoded SignDoc
+	SignModeDirect = "direct"
+	// SignModeAminoJSON signs the legacy amino StdSignDoc JSON, with sorted keys
+	SignModeAminoJSON = "amino-json"
+)
+
+func (b *backend) signCosmos(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	from := data.Get("name").(string)
+
+	sign, err := b.prepareSignCosmos(data)
+	if err != nil {
+		return nil, err
+	}
+	return b.signWithAccount(ctx, req, from, sign)
+}
+
+func (b *backend) prepareSignCosmos(data *framework.FieldData) (signFunc, error) {
+	signDoc := data.Get("signDoc").(string)
+	mode := data.Get("mode").(string)
+	format := data.Get("format").(string)
+	if format != "hex" && format != "base64" {
+		return nil, fmt.Errorf("Unsupported signature format %s", format)
+	}
+
+	var signBytes []byte
+	switch mode {
+	case SignModeDirect:
+		var err error
+		if format == "hex" {
+			signBytes, err = hexutil.Decode(signDoc)
+		} else {
+			signBytes, err = base64.StdEncoding.DecodeString(signDoc)
+		}
+		if err != nil || len(signBytes) == 0 {
+			return nil, fmt.Errorf("Invalid 'signDoc' value, it must be the %s encoded SignDoc bytes", format)
+		}
+		if err := validateProtobuf(signBytes); err != nil {
+			return nil, fmt.Errorf("Invalid 'signDoc' value, it is not a protobuf message: %v", err)
+		}
+	case SignModeAminoJSON:
+		var err error
+		signBytes, err = sortedAminoJSON(signDoc)
+		if err != nil {
+			b.Logger().Error("Failed to decode the amino sign doc", "error", err)
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("Unsupported 'mode' value %s, it must be %s or %s", mode, SignModeDirect, SignModeAminoJSON)
+	}
+
+	digest := sha256.Sum256(signBytes)
+
+	return func(account *Account, privateKey *ecdsa.PrivateKey) (map[string]interface{}, error) {
+		sig, err := crypto.Sign(digest[:], privateKey)
+		if err != nil {
+			b.Logger().Error("Failed to sign the Cosmos sign doc", "error", err)
+			return nil, err
+		}
+		// Cosmos SDK expects the 64-byte [R || S] signature, with a low S
+		signature, _ := formatSignature(sig[:64], format)
+		publicKey, _ := formatSignature(crypto.CompressPubkey(&privateKey.PublicKey), format)
+
+		result := map[string]interface{}{
+			"signature": signature,
+			"publicKey": publicKey,
+			"digest":    hexutil.Encode(digest[:]),
+		}
+		if mode == SignModeAminoJSON {
+			result["signBytes"] = string(signBytes)
+		}
+		return result, nil
+	}, nil
+}
+
+// sortedAminoJSON returns the bytes signed for a legacy amino StdSignDoc, the compact JSON with
+// the keys of all the objects sorted, as computed by the Cosmos SDK
+func sortedAminoJSON(signDoc string) ([]byte, error) {
+	decoder := json.NewDecoder(strings.NewReader(signDoc))
+	decoder.UseNumber()
+	var doc map[string]interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("Invalid 'signDoc' value: %v", err)
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("Invalid 'signDoc' value: unexpected data after the JSON object")
+	}
+	for _, field := range []string{"chain_id", "msgs"} {
+		if _, ok := doc[field]; !ok {
+			return nil, fmt.Errorf("'signDoc' is not an amino StdSignDoc, '%s' is missing", field)
+		}
+	}
+	// maps are marshaled with sorted keys
+	return json.Marshal(doc)
+}
@@ -0,0 +1,180 @@
+package backend
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestCosmosAddresses(t *testing.T) {
+	assert := assert.New(t)
+
+	b, storage := getBackend(t)
+
+	// RIPEMD160(SHA256(compressed generator point)) is 751e76e8199196d454941c45d1b3a323f1433bd6
+	key := "0000000000000000000000000000000000000000000000000000000000000001"
+	for hrp, expected := range map[string]string{
+		"":     "cosmos1w508d6qejxtdg4y5r3zarvary0c5xw7k6ah60c",
+		"osmo": "osmo1w508d6qejxtdg4y5r3zarvary0c5xw7kjxy2e2",
+	} {
+		req := logical.TestRequest(t, logical.UpdateOperation, "accounts")
+		req.Storage = storage
+		req.Data = map[string]interface{}{
+			"privateKey":  key,
+			"addressType": "COSMOS",
+			"hrp":         hrp,
+		}
+		res, err := b.HandleRequest(context.Background(), req)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		assert.Equal(expected, res.Data["address"].(string))
+	}
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "accounts")
+	req.Storage = storage
+	req.Data = map[string]interface{}{
+		"privateKey":  key,
+		"addressType": "ETH",
+		"hrp":         "osmo",
+	}
+	_, err := b.HandleRequest(context.Background(), req)
+	assert.Equal("'hrp' is only supported by the COSMOS address type", err.Error())
+
+	req.Data = map[string]interface{}{
+		"privateKey":  key,
+		"addressType": "COSMOS",
+		"hrp":         "Osmo",
+	}
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.Equal("Invalid 'hrp' value Osmo, it must be lower case letters and digits", err.Error())
+
+	// coin 118 derives m/44'/118'/0'/0/index, as Keplr and the cosmos CLI do
+	req = logical.TestRequest(t, logical.CreateOperation, "wallets/w1")
+	req.Storage = storage
+	req.Data = map[string]interface{}{
+		"mnemonic": "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+	}
+	if _, err := b.HandleRequest(context.Background(), req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req = logical.TestRequest(t, logical.CreateOperation, "wallets/w1/derive")
+	req.Storage = storage
+	req.Data = map[string]interface{}{
+		"coin": 118,
+	}
+	res, err := b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	assert.Equal("cosmos19rl4cm2hmr8afy4kldpxz3fka4jguq0auqdal4", res.Data["address"].(string))
+	assert.Equal("m/44'/118'/0'/0/0", res.Data["derivationPath"].(string))
+
+	req.Data = map[string]interface{}{
+		"coin":  118,
+		"index": 1,
+		"hrp":   "osmo",
+	}
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	assert.Regexp("^osmo1", res.Data["address"].(string))
+}
+
+func TestSignCosmos(t *testing.T) {
+	assert := assert.New(t)
+
+	b, storage := getBackend(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "accounts")
+	req.Storage = storage
+	req.Data = map[string]interface{}{
+		"privateKey":  "ec85999367d32fbbe02dd600a2a44550b95274cc67d14375a9f0bce233f13ad2",
+		"addressType": "COSMOS",
+	}
+	res, err := b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	address := res.Data["address"].(string)
+	privateKey, _ := crypto.HexToECDSA("ec85999367d32fbbe02dd600a2a44550b95274cc67d14375a9f0bce233f13ad2")
+	compressed := crypto.CompressPubkey(&privateKey.PublicKey)
+
+	// body_bytes, auth_info_bytes, chain_id and account_number of a SignDoc
+	signDoc := protowire.AppendTag(nil, 1, protowire.BytesType)
+	signDoc = protowire.AppendBytes(signDoc, []byte{0x0a, 0x00})
+	signDoc = protowire.AppendTag(signDoc, 2, protowire.BytesType)
+	signDoc = protowire.AppendBytes(signDoc, []byte{0x12, 0x00})
+	signDoc = protowire.AppendTag(signDoc, 3, protowire.BytesType)
+	signDoc = protowire.AppendString(signDoc, "cosmoshub-4")
+	signDoc = protowire.AppendTag(signDoc, 4, protowire.VarintType)
+	signDoc = protowire.AppendVarint(signDoc, 42)
+
+	req = logical.TestRequest(t, logical.CreateOperation, "accounts/"+address+"/sign-cosmos")
+	req.Storage = storage
+	req.Data = map[string]interface{}{
+		"signDoc": base64.StdEncoding.EncodeToString(signDoc),
+	}
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	digest := sha256.Sum256(signDoc)
+	signature, _ := base64.StdEncoding.DecodeString(res.Data["signature"].(string))
+	assert.Equal(64, len(signature))
+	assert.True(crypto.VerifySignature(compressed, digest[:], signature))
+	assert.Equal(base64.StdEncoding.EncodeToString(compressed), res.Data["publicKey"].(string))
+	assert.Nil(res.Data["signBytes"])
+
+	req.Data = map[string]interface{}{
+		"signDoc": "0x" + base64.StdEncoding.EncodeToString(signDoc),
+		"format":  "hex",
+	}
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.Equal("Invalid 'signDoc' value, it must be the hex encoded SignDoc bytes", err.Error())
+
+	// the amino JSON is signed with sorted keys and without whitespace
+	req.Data = map[string]interface{}{
+		"mode": "amino-json",
+		"signDoc": `{
+			"chain_id": "cosmoshub-4",
+			"account_number": "42",
+			"sequence": "7",
+			"fee": {"gas": "200000", "amount": [{"denom": "uatom", "amount": "5000"}]},
+			"msgs": [{"type": "cosmos-sdk/MsgSend", "value": {"from_address": "cosmos1a", "to_address": "cosmos1b", "amount": [{"denom": "uatom", "amount": "1000"}]}}],
+			"memo": ""
+		}`,
+		"format": "hex",
+	}
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	signBytes := `{"account_number":"42","chain_id":"cosmoshub-4","fee":{"amount":[{"amount":"5000","denom":"uatom"}],"gas":"200000"},"memo":"","msgs":[{"type":"cosmos-sdk/MsgSend","value":{"amount":[{"amount":"1000","denom":"uatom"}],"from_address":"cosmos1a","to_address":"cosmos1b"}}],"sequence":"7"}`
+	assert.Equal(signBytes, res.Data["signBytes"].(string))
+	digest = sha256.Sum256([]byte(signBytes))
+	signature, _ = decodeSignature(res.Data["signature"].(string), "hex")
+	assert.True(crypto.VerifySignature(compressed, digest[:], signature))
+
+	for _, test := range []struct {
+		data     map[string]interface{}
+		expected string
+	}{
+		{map[string]interface{}{"signDoc": "CgA=", "mode": "textual"}, "Unsupported 'mode' value textual, it must be direct or amino-json"},
+		{map[string]interface{}{"signDoc": "CgA=", "format": "der"}, "Unsupported signature format der"},
+		{map[string]interface{}{"signDoc": "CgU="}, "Invalid 'signDoc' value, it is not a protobuf message: unexpected EOF"},
+		{map[string]interface{}{"signDoc": `{"chain_id":"x"}`, "mode": "amino-json"}, "'signDoc' is not an amino StdSignDoc, 'msgs' is missing"},
+		{map[string]interface{}{"signDoc": `{"chain_id":"x","msgs":[]} {}`, "mode": "amino-json"}, "Invalid 'signDoc' value: unexpected data after the JSON object"},
+	} {
+		req.Data = test.data
+		_, err = b.HandleRequest(context.Background(), req)
+		assert.Equal(test.expected, err.Error())
+	}
+}
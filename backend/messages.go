@@ -0,0 +1,170 @@
+// Copyright © 2020 Kaleido
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// EIP-191 version byte for data with an intended validator
+	eip191VersionValidator = "0x00"
+	// EIP-191 version byte for personal_sign messages
+	eip191VersionPersonal = "0x45"
+)
+
+func (b *backend) signMessage(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	from := data.Get("name").(string)
+
+	sign, err := b.prepareSignMessage(data)
+	if err != nil {
+		return nil, err
+	}
+	return b.signWithAccount(ctx, req, from, sign)
+}
+
+// prepareSignMessage computes the EIP-191 digest of the message and returns the function signing it
+func (b *backend) prepareSignMessage(data *framework.FieldData) (signFunc, error) {
+	message, err := decodeMessage(data.Get("message").(string), data.Get("messageFormat").(string))
+	if err != nil {
+		b.Logger().Error("Failed to decode message", "error", err)
+		return nil, err
+	}
+
+	digest, err := eip191Hash(message, data.Get("version").(string), data.Get("validator").(string))
+	if err != nil {
+		b.Logger().Error("Failed to hash message", "error", err)
+		return nil, err
+	}
+
+	return func(account *Account, privateKey *ecdsa.PrivateKey) (map[string]interface{}, error) {
+		sig, err := crypto.Sign(digest, privateKey)
+		if err != nil {
+			b.Logger().Error("Failed to sign the message", "error", err)
+			return nil, err
+		}
+		// wallets return v in the legacy 27/28 form
+		sig[crypto.RecoveryIDOffset] += 27
+
+		return map[string]interface{}{
+			"signature": hexutil.Encode(sig),
+			"digest":    hexutil.Encode(digest),
+		}, nil
+	}, nil
+}
+
+func (b *backend) signTypedData(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	from := data.Get("name").(string)
+
+	sign, err := b.prepareSignTypedData(data)
+	if err != nil {
+		return nil, err
+	}
+	return b.signWithAccount(ctx, req, from, sign)
+}
+
+// prepareSignTypedData computes the EIP-712 digest of the typed data and returns the function signing it
+func (b *backend) prepareSignTypedData(data *framework.FieldData) (signFunc, error) {
+	var typedData apitypes.TypedData
+	if err := json.Unmarshal([]byte(data.Get("typedData").(string)), &typedData); err != nil {
+		b.Logger().Error("Failed to decode typed data", "error", err)
+		return nil, fmt.Errorf("Invalid 'typedData' value: %v", err)
+	}
+	domainSeparator, messageHash, digest, err := eip712Hash(&typedData)
+	if err != nil {
+		b.Logger().Error("Failed to hash typed data", "error", err)
+		return nil, fmt.Errorf("Failed to hash typed data: %v", err)
+	}
+
+	return func(account *Account, privateKey *ecdsa.PrivateKey) (map[string]interface{}, error) {
+		sig, err := crypto.Sign(digest, privateKey)
+		if err != nil {
+			b.Logger().Error("Failed to sign the typed data", "error", err)
+			return nil, err
+		}
+		// same as eth_signTypedData_v4, v is returned in the legacy 27/28 form
+		sig[crypto.RecoveryIDOffset] += 27
+
+		return map[string]interface{}{
+			"signature":       hexutil.Encode(sig),
+			"digest":          hexutil.Encode(digest),
+			"domainSeparator": hexutil.Encode(domainSeparator),
+			"messageHash":     hexutil.Encode(messageHash),
+		}, nil
+	}, nil
+}
+
+// eip712Hash computes the domain separator, the struct hash of the message and the final
+// keccak256(0x19 || 0x01 || domainSeparator || messageHash) digest of EIP-712 typed data.
+// When the primary type is the domain itself, the message hash is omitted from the digest.
+func eip712Hash(typedData *apitypes.TypedData) ([]byte, []byte, []byte, error) {
+	domainSeparator, err := typedData.HashStruct("EIP712Domain", typedData.Domain.Map())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if typedData.PrimaryType == "EIP712Domain" {
+		return domainSeparator, nil, crypto.Keccak256([]byte{0x19, 0x01}, domainSeparator), nil
+	}
+	messageHash, err := typedData.HashStruct(typedData.PrimaryType, typedData.Message)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return domainSeparator, messageHash, crypto.Keccak256([]byte{0x19, 0x01}, domainSeparator, messageHash), nil
+}
+
+// decodeMessage returns the bytes of the message, given either as plain text or as a hex string
+func decodeMessage(message string, format string) ([]byte, error) {
+	switch format {
+	case "", "text":
+		return []byte(message), nil
+	case "hex":
+		decoded, err := hexutil.Decode(message)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid hex 'message' value: %v", err)
+		}
+		return decoded, nil
+	default:
+		return nil, fmt.Errorf("Unsupported 'messageFormat' value %s", format)
+	}
+}
+
+// eip191Hash computes the EIP-191 digest of the message for the given version byte
+func eip191Hash(message []byte, version string, validator string) ([]byte, error) {
+	switch version {
+	case "", eip191VersionPersonal:
+		if validator != "" {
+			return nil, fmt.Errorf("'validator' is only supported with version %s", eip191VersionValidator)
+		}
+		return accounts.TextHash(message), nil
+	case eip191VersionValidator:
+		if !common.IsHexAddress(validator) {
+			return nil, fmt.Errorf("Version %s requires a valid 'validator' address", eip191VersionValidator)
+		}
+		return crypto.Keccak256([]byte{0x19, 0x00}, common.HexToAddress(validator).Bytes(), message), nil
+	default:
+		return nil, fmt.Errorf("Unsupported EIP-191 version %s", version)
+	}
+}
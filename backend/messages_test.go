@@ -0,0 +1,168 @@
+package backend
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignMessage(t *testing.T) {
+	assert := assert.New(t)
+
+	b, _ := getBackend(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "accounts")
+	storage := req.Storage
+	req.Data = map[string]interface{}{
+		"privateKey": "ec85999367d32fbbe02dd600a2a44550b95274cc67d14375a9f0bce233f13ad2",
+	}
+	res, err := b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	address := res.Data["address"].(string)
+
+	// personal_sign
+	req = logical.TestRequest(t, logical.CreateOperation, "accounts/"+address+"/sign-message")
+	req.Storage = storage
+	req.Data = map[string]interface{}{
+		"message": "hello world",
+	}
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	digest := res.Data["digest"].(string)
+	assert.Equal(hexutil.Encode(accounts.TextHash([]byte("hello world"))), digest)
+
+	sig, _ := hexutil.Decode(res.Data["signature"].(string))
+	assert.Equal(65, len(sig))
+	assert.True(sig[64] == 27 || sig[64] == 28)
+	sig[64] -= 27
+	pub, err := crypto.SigToPub(accounts.TextHash([]byte("hello world")), sig)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	assert.Equal(address, strings.ToLower(crypto.PubkeyToAddress(*pub).Hex()))
+
+	// hex encoded message gives the same signature
+	signature := res.Data["signature"].(string)
+	req.Data = map[string]interface{}{
+		"message":       hexutil.Encode([]byte("hello world")),
+		"messageFormat": "hex",
+	}
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	assert.Equal(signature, res.Data["signature"].(string))
+
+	// data with intended validator
+	validator := "0xf809410b0d6f047c603deb311979cd413e025a84"
+	req.Data = map[string]interface{}{
+		"message":   "hello world",
+		"version":   "0x00",
+		"validator": validator,
+	}
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	validatorBytes, _ := hexutil.Decode(validator)
+	expected := crypto.Keccak256([]byte{0x19, 0x00}, validatorBytes, []byte("hello world"))
+	assert.Equal(hexutil.Encode(expected), res.Data["digest"].(string))
+
+	req.Data["validator"] = ""
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.Equal("Version 0x00 requires a valid 'validator' address", err.Error())
+
+	req.Data["version"] = "0x01"
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.Equal("Unsupported EIP-191 version 0x01", err.Error())
+
+	req.Data = map[string]interface{}{
+		"message":       "0xzz",
+		"messageFormat": "hex",
+	}
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.True(strings.HasPrefix(err.Error(), "Invalid hex 'message' value"))
+}
+
+func TestSignTypedData(t *testing.T) {
+	assert := assert.New(t)
+
+	b, _ := getBackend(t)
+
+	// example from the EIP-712 specification, signed with keccak256("cow")
+	req := logical.TestRequest(t, logical.UpdateOperation, "accounts")
+	storage := req.Storage
+	req.Data = map[string]interface{}{
+		"privateKey": hexutil.Encode(crypto.Keccak256([]byte("cow"))),
+	}
+	res, err := b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	address := res.Data["address"].(string)
+	assert.Equal("0xcd2a3d9f938e13cd947ec05abc7fe734df8dd826", address)
+
+	typedData := `{
+		"types": {
+			"EIP712Domain": [
+				{"name": "name", "type": "string"},
+				{"name": "version", "type": "string"},
+				{"name": "chainId", "type": "uint256"},
+				{"name": "verifyingContract", "type": "address"}
+			],
+			"Person": [
+				{"name": "name", "type": "string"},
+				{"name": "wallet", "type": "address"}
+			],
+			"Mail": [
+				{"name": "from", "type": "Person"},
+				{"name": "to", "type": "Person"},
+				{"name": "contents", "type": "string"}
+			]
+		},
+		"primaryType": "Mail",
+		"domain": {
+			"name": "Ether Mail",
+			"version": "1",
+			"chainId": 1,
+			"verifyingContract": "0xCcCCccccCCCCcCCCCCCcCcCccCcCCCcCcccccccC"
+		},
+		"message": {
+			"from": {"name": "Cow", "wallet": "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826"},
+			"to": {"name": "Bob", "wallet": "0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB"},
+			"contents": "Hello, Bob!"
+		}
+	}`
+
+	req = logical.TestRequest(t, logical.CreateOperation, "accounts/"+address+"/sign-typed-data")
+	req.Storage = storage
+	req.Data = map[string]interface{}{
+		"typedData": typedData,
+	}
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	assert.Equal("0xf2cee375fa42b42143804025fc449deafd50cc031ca257e0b194a650a912090f", res.Data["domainSeparator"].(string))
+	assert.Equal("0xc52c0ee5d84264471806290a3f2c4cecfc5490626bf912d01f240d7a274b371e", res.Data["messageHash"].(string))
+	assert.Equal("0xbe609aee343fb3c4b28e1df9e632fca64fcfaede20f02e86244efddf30957bd2", res.Data["digest"].(string))
+	assert.Equal("0x4355c47d63924e8a72e509b65029052eb6c299d53a04e167c5775fd466751c9d07299936d304c153f6443dfa05f40ff007d72911b6f72307f996231605b915621c", res.Data["signature"].(string))
+
+	req.Data["typedData"] = strings.Replace(typedData, `"primaryType": "Mail"`, `"primaryType": "Letter"`, 1)
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.True(strings.HasPrefix(err.Error(), "Failed to hash typed data: "))
+
+	req.Data["typedData"] = "{"
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.True(strings.HasPrefix(err.Error(), "Invalid 'typedData' value: "))
+}
@@ -27,7 +27,12 @@ func pathCreateAndList(b *backend) *framework.Path {
 			},
 			"addressType": &framework.FieldSchema{
 				Type:        framework.TypeString,
-				Description: "Type of address to be generated (possible values are ETH, P2PK, P2PKH, P2SH, P2WPKH, P2WSH, P2TR). If not present, the request generate ETH address.",
+				Description: "Type of address to be generated (possible values are ETH, TRON, P2PKH, P2PKH-Testnet, P2WPKH, P2WPKH-Testnet, P2WPKH-Regtest, P2TR, P2TR-Testnet, P2TR-Regtest, P2SH-P2WPKH, P2SH-P2WPKH-Testnet, P2SH-P2WPKH-Regtest, LTC-P2PKH, LTC-P2WPKH, LTC-P2SH-P2WPKH, DOGE-P2PKH, BCH, COSMOS, XRPL). If not present, the request generate ETH address.",
+				Default:     "",
+			},
+			"hrp": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Human readable part of COSMOS addresses, e.g. osmo. If not present, cosmos is used.",
 				Default:     "",
 			},
 		},
@@ -44,7 +44,7 @@ func pathSign(b *backend) *framework.Path {
 			},
 			"gasPrice": &framework.FieldSchema{
 				Type:        framework.TypeString,
-				Description: "(optional, default: 0) The gas price for the transaction in wei.",
+				Description: "(optional, default: 0) The gas price for the transaction in wei. Used by type 0 and type 1 transactions.",
 				Default:     "0",
 			},
 			"chainId": &framework.FieldSchema{
@@ -52,6 +52,44 @@ func pathSign(b *backend) *framework.Path {
 				Description: "(optional) Chain ID of the target blockchain network. If present, EIP155 signer will be used to sign. If omitted, Homestead signer will be used.",
 				Default:     "0",
 			},
+			"type": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "(optional, default: 0) Transaction type: 0 for legacy, 1 for EIP-2930 access list, 2 for EIP-1559 dynamic fee, 3 for EIP-4844 blob, 4 for EIP-7702 set code transactions. Typed transactions require 'chainId'.",
+				Default:     "0",
+			},
+			"maxFeePerGas": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "(type 2, 3 and 4 only) The maximum total fee per gas the sender is willing to pay in wei, including the base fee.",
+				Default:     "0",
+			},
+			"maxPriorityFeePerGas": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "(type 2, 3 and 4 only) The maximum fee per gas paid to the block producer in wei on top of the base fee.",
+				Default:     "0",
+			},
+			"accessList": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "(optional, typed transactions only) JSON encoded access list, e.g. [{\"address\":\"0x...\",\"storageKeys\":[\"0x...\"]}].",
+				Default:     "",
+			},
+			"maxFeePerBlobGas": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "(type 3 only) The maximum fee per blob gas the sender is willing to pay in wei.",
+				Default:     "0",
+			},
+			"blobVersionedHashes": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: "(type 3 only) Hex encoded versioned hashes of the blobs carried by the transaction. Optional when 'blobs' is provided, in which case they are checked against the computed ones.",
+			},
+			"blobs": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: "(optional, type 3 only) Hex encoded 131072-byte blobs. If present, the KZG commitments and proofs are computed and the network encoded transaction with the blob sidecar is returned in 'network_transaction'.",
+			},
+			"authorizationList": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "(type 4 only) JSON encoded list of signed EIP-7702 authorizations, e.g. [{\"chainId\":\"0x1\",\"address\":\"0x...\",\"nonce\":\"0x0\",\"yParity\":\"0x0\",\"r\":\"0x...\",\"s\":\"0x...\"}].",
+				Default:     "",
+			},
 		},
 		ExistenceCheck: b.pathExistenceCheck,
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -60,6 +98,38 @@ func pathSign(b *backend) *framework.Path {
 	}
 }
 
+func pathSignAuthorization(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern:      "accounts/" + framework.GenericNameRegex("name") + "/sign-authorization",
+		HelpSynopsis: "Sign an EIP-7702 set code authorization.",
+		HelpDescription: `
+
+    Sign an EIP-7702 authorization tuple (chainId, address, nonce) delegating the account's code to a contract.
+
+    `,
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{Type: framework.TypeString},
+			"chainId": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "(optional, default: 0) Chain ID the authorization is valid on. 0 makes the authorization valid on every chain.",
+				Default:     "0",
+			},
+			"address": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Address of the contract whose code the account delegates to.",
+			},
+			"nonce": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The account nonce at the time the authorization is processed.",
+			},
+		},
+		ExistenceCheck: b.pathExistenceCheck,
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.CreateOperation: b.signAuthorization,
+		},
+	}
+}
+
 func pathSignRaw(b *backend) *framework.Path {
 	return &framework.Path{
 		Pattern:      "accounts/" + framework.GenericNameRegex("name") + "/signRaw",
@@ -75,6 +145,41 @@ func pathSignRaw(b *backend) *framework.Path {
 				Type:        framework.TypeString,
 				Description: "Data to sign, hex encoded byte array",
 			},
+			"hash": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "(optional, default: none) Hash function applied to the payload before signing: 'none' when the payload is already a 32-byte digest, 'keccak256', 'sha256', 'double-sha256', 'sha512/256' or 'blake2b-256'.",
+				Default:     "none",
+			},
+			"scheme": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "(optional, default: ecdsa) Signature scheme: 'ecdsa' for 65-byte recoverable ECDSA signatures, 'schnorr' for 64-byte BIP-340 Schnorr signatures verifiable against the x-only public key.",
+				Default:     SchemeECDSA,
+			},
+			"auxRand": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "(optional, schnorr only) Hex encoded 32-byte auxiliary randomness. Fresh randomness is generated if omitted.",
+				Default:     "",
+			},
+			"taprootTweak": &framework.FieldSchema{
+				Type:        framework.TypeBool,
+				Description: "(optional, default: true, schnorr only) For P2TR accounts, sign with the BIP-86 tweaked key as needed for key-path spends. Set to false to sign with the untweaked internal key.",
+				Default:     true,
+			},
+			"encoding": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "(optional, default: recoverable, ecdsa only) Signature encoding: 'recoverable' for [R || S || V] with V as 0/1, 'eth' with V as 27/28, 'eip155' with V as chainId * 2 + 35/36, 'der' for ASN.1 DER, 'compact' for the 64-byte [R || S]. Schnorr signatures are always compact.",
+				Default:     "",
+			},
+			"chainId": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "(eip155 encoding only) Chain ID used to compute V.",
+				Default:     "0",
+			},
+			"format": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "(optional, default: hex) Format of the returned signature: 'hex' or 'base64'. The 'r', 's' and 'v' response fields are always hex.",
+				Default:     "hex",
+			},
 		},
 		ExistenceCheck: b.pathExistenceCheck,
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -82,3 +187,277 @@ func pathSignRaw(b *backend) *framework.Path {
 		},
 	}
 }
+
+func pathSignMessage(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern:      "accounts/" + framework.GenericNameRegex("name") + "/sign-message",
+		HelpSynopsis: "Sign a message according to EIP-191.",
+		HelpDescription: `
+
+    Sign a message the way wallets do for personal_sign (version 0x45), or
+    for an intended validator (version 0x00). The message is prefixed and
+    hashed by the plugin and the signature is returned with v as 27/28.
+
+    `,
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{Type: framework.TypeString},
+			"message": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The message to sign.",
+			},
+			"messageFormat": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "(optional, default: text) Format of the 'message' value: 'text' for UTF-8 text or 'hex' for a hex encoded byte array.",
+				Default:     "text",
+			},
+			"version": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "(optional, default: 0x45) EIP-191 version byte: 0x45 for personal_sign messages, 0x00 for data with an intended validator.",
+				Default:     "0x45",
+			},
+			"validator": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "(version 0x00 only) Address of the intended validator.",
+				Default:     "",
+			},
+		},
+		ExistenceCheck: b.pathExistenceCheck,
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.CreateOperation: b.signMessage,
+		},
+	}
+}
+
+func pathSignTypedData(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern:      "accounts/" + framework.GenericNameRegex("name") + "/sign-typed-data",
+		HelpSynopsis: "Sign EIP-712 typed structured data.",
+		HelpDescription: `
+
+    Sign typed structured data as eth_signTypedData_v4 does. The response
+    includes the domain separator, the message struct hash and the digest
+    that was signed.
+
+    `,
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{Type: framework.TypeString},
+			"typedData": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "JSON encoded typed data object with the 'types', 'primaryType', 'domain' and 'message' properties.",
+			},
+		},
+		ExistenceCheck: b.pathExistenceCheck,
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.CreateOperation: b.signTypedData,
+		},
+	}
+}
+
+func pathSignPsbt(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern:      "accounts/" + framework.GenericNameRegex("name") + "/sign-psbt",
+		HelpSynopsis: "Sign the inputs of a Bitcoin PSBT.",
+		HelpDescription: `
+
+    Sign every input of a BIP-174 partially signed Bitcoin transaction that
+    spends an output of the account key: P2PKH, P2WPKH, P2SH-P2WPKH and
+    P2TR key-path outputs, as well as P2SH and P2WSH scripts listing the
+    key. Legacy, BIP-143 and BIP-341 signature hashes are computed by the
+    plugin according to the input and its sighash type. BCH accounts sign
+    with SIGHASH_FORKID, the BIP-143 hash being used for all inputs.
+
+    `,
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{Type: framework.TypeString},
+			"psbt": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Base64 encoded PSBT. Inputs must carry their witness or non-witness UTXO.",
+			},
+			"finalize": &framework.FieldSchema{
+				Type:        framework.TypeBool,
+				Description: "(optional, default: false) Finalize all the inputs and return the network encoded transaction in 'signed_transaction'. Fails if any input is missing signatures.",
+				Default:     false,
+			},
+		},
+		ExistenceCheck: b.pathExistenceCheck,
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.CreateOperation: b.signPsbt,
+		},
+	}
+}
+
+func pathSignInput(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern:      "accounts/" + framework.GenericNameRegex("name") + "/sign-input",
+		HelpSynopsis: "Sign an input of a Bitcoin transaction.",
+		HelpDescription: `
+
+    Compute the legacy or BIP-143 signature hash of a transaction input for
+    the given sighash type, and sign it. The signature is returned DER
+    encoded with the sighash type byte appended, ready to be placed in the
+    scriptSig or witness together with the returned public key. BCH accounts
+    sign with SIGHASH_FORKID and require the 'amount' for all inputs.
+
+    `,
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{Type: framework.TypeString},
+			"transaction": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Hex encoded unsigned transaction.",
+			},
+			"inputIndex": &framework.FieldSchema{
+				Type:        framework.TypeInt,
+				Description: "(optional, default: 0) Index of the input to sign.",
+				Default:     0,
+			},
+			"prevScript": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Hex encoded script of the output spent by the input.",
+			},
+			"amount": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "(segwit and BCH only) Value of the output spent by the input, in satoshis.",
+			},
+			"redeemScript": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "(optional, P2SH only) Hex encoded redeem script. Defaults to the P2WPKH script of the account key.",
+				Default:     "",
+			},
+			"witnessScript": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "(P2WSH only) Hex encoded witness script.",
+				Default:     "",
+			},
+			"sighashType": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "(optional, default: ALL) Signature hash type: ALL, NONE or SINGLE, optionally combined with ANYONECANPAY, e.g. 'ALL|ANYONECANPAY'.",
+				Default:     "ALL",
+			},
+		},
+		ExistenceCheck: b.pathExistenceCheck,
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.CreateOperation: b.signInput,
+		},
+	}
+}
+
+func pathSignTron(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern:      "accounts/" + framework.GenericNameRegex("name") + "/sign-tron",
+		HelpSynopsis: "Sign a Tron transaction.",
+		HelpDescription: `
+
+    Sign a Tron transaction given as the hex encoded raw_data protobuf, or as
+    the JSON object returned by TronGrid for unsigned transactions. The txID is
+    the SHA-256 hash of the raw data. The signature is returned along with the
+    protobuf encoded signed transaction, ready for /wallet/broadcasthex, and for
+    JSON input, the transaction object with the signature appended, ready for
+    /wallet/broadcasttransaction.
+
+    `,
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{Type: framework.TypeString},
+			"transaction": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Hex encoded Transaction.raw_data protobuf, or the JSON transaction object with a 'raw_data_hex' value.",
+			},
+		},
+		ExistenceCheck: b.pathExistenceCheck,
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.CreateOperation: b.signTron,
+		},
+	}
+}
+
+func pathSignCosmos(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern:      "accounts/" + framework.GenericNameRegex("name") + "/sign-cosmos",
+		HelpSynopsis: "Sign a Cosmos SDK transaction.",
+		HelpDescription: `
+
+    Sign the SignDoc of a Cosmos SDK transaction, either the protobuf encoded
+    SignDoc of SIGN_MODE_DIRECT or the legacy amino StdSignDoc JSON of
+    SIGN_MODE_LEGACY_AMINO_JSON, whose keys are sorted by the plugin. The sign
+    bytes are hashed with SHA-256 and the 64-byte [R || S] signature is returned
+    along with the compressed public key of the account.
+
+    `,
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{Type: framework.TypeString},
+			"signDoc": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The SignDoc bytes encoded according to 'format' for the direct mode, or the StdSignDoc JSON for the amino-json mode.",
+			},
+			"mode": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "(optional, default: direct) Sign mode: direct or amino-json.",
+				Default:     SignModeDirect,
+			},
+			"format": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "(optional, default: base64) Encoding of the direct mode 'signDoc', and of the returned 'signature' and 'publicKey': base64 or hex.",
+				Default:     "base64",
+			},
+		},
+		ExistenceCheck: b.pathExistenceCheck,
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.CreateOperation: b.signCosmos,
+		},
+	}
+}
+
+func pathSignXrpl(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern:      "accounts/" + framework.GenericNameRegex("name") + "/sign-xrpl",
+		HelpSynopsis: "Sign an XRP Ledger transaction.",
+		HelpDescription: `
+
+    Sign an XRP Ledger transaction given in the binary serialization, with the
+    SigningPubKey of the account and without TxnSignature, as returned by the
+    encodeForSigning function of ripple-binary-codec. The signing hash is the
+    SHA-512Half of the STX\0 prefix and the transaction. The DER encoded
+    signature, with a canonical low S, is returned to be set as TxnSignature.
+
+    `,
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{Type: framework.TypeString},
+			"transaction": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Hex encoded binary serialized transaction, with or without the STX\\0 prefix (53545800).",
+			},
+		},
+		ExistenceCheck: b.pathExistenceCheck,
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.CreateOperation: b.signXrpl,
+		},
+	}
+}
+
+func pathSignBatch(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern:      "accounts/" + framework.GenericNameRegex("name") + "/sign-batch",
+		HelpSynopsis: "Sign a batch of payloads, messages and transactions.",
+		HelpDescription: `
+
+    Sign many items in one request, decoding the account key once. Each
+    item has a 'type' (raw, message, typedData, transaction, tron, cosmos or
+    xrpl) and the same fields as the signRaw, sign-message, sign-typed-data,
+    sign, sign-tron, sign-cosmos or sign-xrpl endpoint. The 'type' of a
+    transaction item is given as 'txType'.
+    The results are returned in the order of the items, failed items carry
+    an 'error' instead of a signature.
+
+    `,
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{Type: framework.TypeString},
+			"items": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "JSON encoded array of items, e.g. [{\"type\":\"raw\",\"payload\":\"0x...\"},{\"type\":\"message\",\"message\":\"hello\"}].",
+			},
+		},
+		ExistenceCheck: b.pathExistenceCheck,
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.CreateOperation: b.signBatch,
+		},
+	}
+}
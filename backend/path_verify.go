@@ -0,0 +1,82 @@
+package backend
+
+import (
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func pathVerify(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern:      "accounts/" + framework.GenericNameRegex("name") + "/verify",
+		HelpSynopsis: "Verify a signature against the account public key.",
+		HelpDescription: `
+
+    Verify an ECDSA or BIP-340 Schnorr signature of a digest against the
+    stored public key of the account. ECDSA signatures are accepted in any
+    of the signRaw encodings.
+
+    `,
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{Type: framework.TypeString},
+			"payload": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The signed digest, hex encoded byte array",
+			},
+			"signature": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The signature to verify: DER, compact [R || S] or [R || S || V] for ECDSA, 64 bytes for Schnorr.",
+			},
+			"format": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "(optional, default: hex) Format of the 'signature' value: 'hex' or 'base64'.",
+				Default:     "hex",
+			},
+			"scheme": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "(optional, default: ecdsa) Signature scheme: 'ecdsa' or 'schnorr'.",
+				Default:     SchemeECDSA,
+			},
+			"taprootTweak": &framework.FieldSchema{
+				Type:        framework.TypeBool,
+				Description: "(optional, default: true, schnorr only) For P2TR accounts, verify against the BIP-86 tweaked key. Set to false to verify against the internal key.",
+				Default:     true,
+			},
+		},
+		ExistenceCheck: b.pathExistenceCheck,
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.CreateOperation: b.verifySignature,
+		},
+	}
+}
+
+func pathRecover(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern:      "recover",
+		HelpSynopsis: "Recover the public key and addresses of a signer.",
+		HelpDescription: `
+
+    Recover the public key from a digest and a recoverable [R || S || V]
+    ECDSA signature, and return it encoded with every supported address
+    type. No account is needed.
+
+    `,
+		Fields: map[string]*framework.FieldSchema{
+			"payload": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The signed 32-byte digest, hex encoded byte array",
+			},
+			"signature": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The [R || S || V] signature, with V as 0/1, 27/28 or an EIP-155 value.",
+			},
+			"format": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "(optional, default: hex) Format of the 'signature' value: 'hex' or 'base64'.",
+				Default:     "hex",
+			},
+		},
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.recoverPublicKey,
+		},
+	}
+}
@@ -0,0 +1,174 @@
+package backend
+
+import (
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func pathListWallets(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "wallets/?",
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.listWallets,
+		},
+		HelpSynopsis: "List all the HD wallets maintained by the plugin backend.",
+		HelpDescription: `
+
+    LIST - list all wallets
+
+    `,
+	}
+}
+
+func pathWallet(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern:      "wallets/" + framework.GenericNameRegex("name"),
+		HelpSynopsis: "Create, get or delete a BIP-32 HD wallet by name",
+		HelpDescription: `
+
+    POST - create a new wallet with the name from generated entropy, from an imported seed
+           or BIP-39 mnemonic, or from a newly generated BIP-39 mnemonic
+    GET - return the wallet by the name
+    DELETE - deletes the wallet by the name, along with the accounts derived from it
+
+    `,
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{Type: framework.TypeString},
+			"seed": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Hexidecimal string for the master seed (16 to 64 bytes). If present, the request will import the given seed instead of generating a new one.",
+				Default:     "",
+			},
+			"mnemonic": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "BIP-39 mnemonic from the English wordlist. If present, the request will import the seed of the mnemonic.",
+				Default:     "",
+			},
+			"words": &framework.FieldSchema{
+				Type:        framework.TypeInt,
+				Description: "Number of words (12, 15, 18, 21 or 24) of a BIP-39 mnemonic to generate for the wallet. The mnemonic is returned once, encrypted with 'rsaPublicKey'.",
+				Default:     0,
+			},
+			"passphrase": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Optional BIP-39 passphrase, used with 'mnemonic' or 'words'.",
+				Default:     "",
+			},
+			"rsaPublicKey": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Armored PGP public key to encrypt the generated mnemonic with, required with 'words'.",
+				Default:     "",
+			},
+		},
+		ExistenceCheck: b.pathExistenceCheck,
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.CreateOperation: b.createWallet,
+			logical.ReadOperation:   b.readWallet,
+			logical.DeleteOperation: b.deleteWallet,
+		},
+	}
+}
+
+func pathWalletDerive(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern:      "wallets/" + framework.GenericNameRegex("name") + "/derive",
+		HelpSynopsis: "Derive an account from a wallet.",
+		HelpDescription: `
+
+    Derive the key at a BIP-32 path of the wallet and save it as an account,
+    usable by all the account endpoints. Only the wallet name and the path are
+    stored with the account, the key is derived again from the wallet seed
+    whenever the account signs.
+
+    Instead of a path and an address type, a SLIP-44 'coin' type can be given
+    along with the 'index' of the address, the standard path and address type of
+    the coin are then used:
+
+      0 (bitcoin), 1 (testnet)  m/84'/coin'/account'/change/index  P2WPKH
+      2 (litecoin)              m/84'/2'/account'/change/index     LTC-P2WPKH
+      3 (dogecoin)              m/44'/3'/account'/change/index     DOGE-P2PKH
+      60 (ethereum)             m/44'/60'/account'/change/index    ETH
+      118 (cosmos)              m/44'/118'/account'/change/index   COSMOS
+      144 (xrp)                 m/44'/144'/account'/change/index   XRPL
+      145 (bitcoin cash)        m/44'/145'/account'/change/index   BCH
+      195 (tron)                m/44'/195'/account'/change/index   TRON
+
+    `,
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{Type: framework.TypeString},
+			"path": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "BIP-32 derivation path, e.g. m/44'/60'/0'/0/0. Hardened indexes are marked with ' or h.",
+				Default:     "",
+			},
+			"addressType": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Type of address to be generated, same values as when creating accounts. If not present, the request generate ETH address.",
+				Default:     "",
+			},
+			"hrp": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Human readable part of COSMOS addresses, e.g. osmo. If not present, cosmos is used.",
+				Default:     "",
+			},
+			"coin": &framework.FieldSchema{
+				Type:        framework.TypeInt,
+				Description: "SLIP-44 coin type selecting the standard path and address type, instead of 'path' and 'addressType'.",
+			},
+			"account": &framework.FieldSchema{
+				Type:        framework.TypeInt,
+				Description: "Account index of the path when deriving by 'coin'.",
+				Default:     0,
+			},
+			"change": &framework.FieldSchema{
+				Type:        framework.TypeBool,
+				Description: "Derive a change address (chain 1) instead of a receive address when deriving by 'coin'.",
+				Default:     false,
+			},
+			"index": &framework.FieldSchema{
+				Type:        framework.TypeInt,
+				Description: "Address index of the path when deriving by 'coin'.",
+				Default:     0,
+			},
+		},
+		ExistenceCheck: b.pathExistenceCheck,
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.CreateOperation: b.deriveAccount,
+		},
+	}
+}
+
+func pathWalletXpub(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern:      "wallets/" + framework.GenericNameRegex("name") + "/xpub",
+		HelpSynopsis: "Export an extended public key of a wallet.",
+		HelpDescription: `
+
+    Return the extended public key at a BIP-32 path of the wallet, typically the
+    account level path such as m/84'/0'/0', for watch-only services to derive the
+    same receive and change addresses as the derive endpoint, whose P2PKH
+    accounts hash the compressed public key like other HD wallets. The version
+    bytes follow SLIP-132 for the purpose of the path (xpub for 44' and 86', ypub
+    for 49', zpub for 84'), with the testnet variants for coin type 1'. The
+    Litecoin and Dogecoin paths registered by SLIP-132 get their own version
+    bytes: Ltub for m/44'/2', Mtub for m/49'/2' and dgub for m/44'/3'. The
+    other paths of those coins, such as m/84'/2', use the Bitcoin version bytes.
+
+    `,
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{Type: framework.TypeString},
+			"path": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "BIP-32 derivation path of the extended key, e.g. m/84'/0'/0'.",
+			},
+			"format": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Version bytes of the extended key, slip132 (default) or bip32 to always use xpub/tpub.",
+				Default:     "slip132",
+			},
+		},
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.exportExtendedPublicKey,
+		},
+	}
+}
@@ -0,0 +1,360 @@
+// Copyright © 2020 Kaleido
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	btcecdsa "github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	// SchemeECDSA is the default signature scheme
+	SchemeECDSA string = "ecdsa"
+	// SchemeSchnorr selects BIP-340 Schnorr signatures
+	SchemeSchnorr string = "schnorr"
+)
+
+// payloadHashes are the 'hash' modes of signRaw, applied to the payload to obtain the signed digest
+var payloadHashes = map[string]func([]byte) []byte{
+	"keccak256": func(b []byte) []byte {
+		return crypto.Keccak256(b)
+	},
+	"sha256": func(b []byte) []byte {
+		h := sha256.Sum256(b)
+		return h[:]
+	},
+	// as used by Bitcoin
+	"double-sha256": func(b []byte) []byte {
+		h := sha256.Sum256(b)
+		h = sha256.Sum256(h[:])
+		return h[:]
+	},
+	"sha512/256": func(b []byte) []byte {
+		h := sha512.Sum512_256(b)
+		return h[:]
+	},
+	"blake2b-256": func(b []byte) []byte {
+		h := blake2b.Sum256(b)
+		return h[:]
+	},
+}
+
+// hashPayload returns the 32-byte digest to sign. With the "none" mode the payload must
+// already be a digest, otherwise it is the preimage hashed with the given function.
+func hashPayload(payload []byte, mode string) ([]byte, error) {
+	if mode == "" || mode == "none" {
+		if len(payload) != 32 {
+			return nil, fmt.Errorf("'payload' must be a 32-byte digest when 'hash' is none, got %d bytes", len(payload))
+		}
+		return payload, nil
+	}
+	hash, ok := payloadHashes[mode]
+	if !ok {
+		return nil, fmt.Errorf("Unsupported 'hash' value %s", mode)
+	}
+	return hash(payload), nil
+}
+
+// ECDSA signature encodings
+const (
+	// EncodingRecoverable is the go-ethereum [R || S || V] format with V as 0/1
+	EncodingRecoverable string = "recoverable"
+	// EncodingETH is [R || S || V] with V as 27/28, as returned by Ethereum wallets
+	EncodingETH string = "eth"
+	// EncodingEIP155 is [R || S || V] with V as chainId * 2 + 35/36
+	EncodingEIP155 string = "eip155"
+	// EncodingDER is the ASN.1 DER encoding used by Bitcoin and X.509
+	EncodingDER string = "der"
+	// EncodingCompact is the 64-byte [R || S] encoding
+	EncodingCompact string = "compact"
+)
+
+// toBtcecKey converts the go-ethereum key representation to the btcec one,
+// the returned key must be zeroed by the caller
+func toBtcecKey(privateKey *ecdsa.PrivateKey) *btcec.PrivateKey {
+	keyBytes := crypto.FromECDSA(privateKey)
+	defer zeroBytes(keyBytes)
+	key, _ := btcec.PrivKeyFromBytes(keyBytes)
+	return key
+}
+
+// signSchnorr produces a 64-byte BIP-340 signature of the 32-byte digest. The aux randomness
+// is hex encoded, fresh randomness is used when it is empty as recommended by BIP-340.
+// With taprootTweak the key is first tweaked as for a BIP-86 key-path spend.
+func signSchnorr(privateKey *ecdsa.PrivateKey, digest []byte, auxRandInput string, taprootTweak bool) ([]byte, error) {
+	var auxRand [32]byte
+	if auxRandInput == "" {
+		if _, err := rand.Read(auxRand[:]); err != nil {
+			return nil, err
+		}
+	} else {
+		decoded, err := hexutil.Decode(auxRandInput)
+		if err != nil || len(decoded) != len(auxRand) {
+			return nil, fmt.Errorf("'auxRand' must be a 32-byte hex string")
+		}
+		copy(auxRand[:], decoded)
+	}
+
+	key := toBtcecKey(privateKey)
+	defer key.Zero()
+	if taprootTweak {
+		key = txscript.TweakTaprootPrivKey(key, []byte{})
+		defer key.Zero()
+	}
+
+	sig, err := schnorr.Sign(key, digest, schnorr.CustomNonce(auxRand))
+	if err != nil {
+		return nil, err
+	}
+	return sig.Serialize(), nil
+}
+
+// encodeECDSASignature converts a 65-byte [R || S || V] signature produced by crypto.Sign to the
+// given encoding, and returns the V value of that encoding along with it. The compact and DER
+// encodings carry no V, the recovery id is returned for them.
+func encodeECDSASignature(sig []byte, encoding string, chainId *big.Int) ([]byte, *big.Int, error) {
+	recoveryId := sig[crypto.RecoveryIDOffset]
+	switch encoding {
+	case "", EncodingRecoverable:
+		return sig, big.NewInt(int64(recoveryId)), nil
+	case EncodingETH:
+		encoded := append([]byte{}, sig...)
+		encoded[crypto.RecoveryIDOffset] += 27
+		return encoded, big.NewInt(int64(encoded[crypto.RecoveryIDOffset])), nil
+	case EncodingEIP155:
+		if chainId == nil || chainId.Sign() <= 0 {
+			return nil, nil, fmt.Errorf("'chainId' is required for the %s encoding", EncodingEIP155)
+		}
+		v := new(big.Int).Mul(chainId, big.NewInt(2))
+		v.Add(v, big.NewInt(35+int64(recoveryId)))
+		// V is appended big-endian, taking more than one byte for large chain ids
+		return append(append([]byte{}, sig[:crypto.RecoveryIDOffset]...), v.Bytes()...), v, nil
+	case EncodingCompact:
+		return sig[:crypto.RecoveryIDOffset], big.NewInt(int64(recoveryId)), nil
+	case EncodingDER:
+		var r, s btcec.ModNScalar
+		r.SetByteSlice(sig[:32])
+		s.SetByteSlice(sig[32:64])
+		return btcecdsa.NewSignature(&r, &s).Serialize(), big.NewInt(int64(recoveryId)), nil
+	default:
+		return nil, nil, fmt.Errorf("Unsupported signature encoding %s", encoding)
+	}
+}
+
+// decodeECDSASignature parses the encodings produced by signRaw: DER, compact [R || S] and
+// [R || S || V] with any of the V conventions. The recovery id is -1 when the encoding has none.
+func decodeECDSASignature(sig []byte) (*btcecdsa.Signature, []byte, int, error) {
+	if isDERSignature(sig) {
+		parsed, err := btcecdsa.ParseDERSignature(sig)
+		if err != nil {
+			return nil, nil, -1, fmt.Errorf("Invalid DER signature: %v", err)
+		}
+		return parsed, nil, -1, nil
+	}
+	if len(sig) < 64 {
+		return nil, nil, -1, fmt.Errorf("Invalid signature length %d", len(sig))
+	}
+
+	var r, s btcec.ModNScalar
+	if r.SetByteSlice(sig[:32]) || s.SetByteSlice(sig[32:64]) || r.IsZero() || s.IsZero() {
+		return nil, nil, -1, fmt.Errorf("Invalid signature, R and S must be in the range [1, N-1]")
+	}
+	parsed := btcecdsa.NewSignature(&r, &s)
+	if len(sig) == 64 {
+		return parsed, sig, -1, nil
+	}
+
+	var recoveryId int64
+	switch v := new(big.Int).SetBytes(sig[64:]); {
+	case v.Cmp(big.NewInt(1)) <= 0:
+		recoveryId = v.Int64()
+	case v.Cmp(big.NewInt(27)) == 0 || v.Cmp(big.NewInt(28)) == 0:
+		recoveryId = v.Int64() - 27
+	case v.Cmp(big.NewInt(35)) >= 0:
+		// EIP-155, V = chainId * 2 + 35 + recovery id
+		recoveryId = int64(new(big.Int).Sub(v, big.NewInt(35)).Bit(0))
+	default:
+		return nil, nil, -1, fmt.Errorf("Invalid signature V value %d", v)
+	}
+	return parsed, sig[:64], int(recoveryId), nil
+}
+
+// isDERSignature tells whether the signature has the structure of a DER encoded SEQUENCE of the
+// two INTEGERs R and S. A leading 0x30 alone is not enough, R of an [R || S || V] signature may
+// start with it.
+func isDERSignature(sig []byte) bool {
+	if len(sig) < 8 || sig[0] != 0x30 || int(sig[1]) != len(sig)-2 || sig[2] != 0x02 {
+		return false
+	}
+	rLen := int(sig[3])
+	if 6+rLen > len(sig) || sig[4+rLen] != 0x02 {
+		return false
+	}
+	return 6+rLen+int(sig[5+rLen]) == len(sig)
+}
+
+// decodeSignature reads a signature given as 0x prefixed hex or as base64
+func decodeSignature(input string, format string) ([]byte, error) {
+	switch format {
+	case "", "hex":
+		sig, err := hexutil.Decode(input)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid hex 'signature' value: %v", err)
+		}
+		return sig, nil
+	case "base64":
+		sig, err := base64.StdEncoding.DecodeString(input)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid base64 'signature' value: %v", err)
+		}
+		return sig, nil
+	default:
+		return nil, fmt.Errorf("Unsupported signature format %s", format)
+	}
+}
+
+// formatSignature renders the signature bytes as 0x prefixed hex or as base64
+func formatSignature(sig []byte, format string) (string, error) {
+	switch format {
+	case "", "hex":
+		return hexutil.Encode(sig), nil
+	case "base64":
+		return encodeBase64(sig), nil
+	default:
+		return "", fmt.Errorf("Unsupported signature format %s", format)
+	}
+}
+
+func (b *backend) verifySignature(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	digest, err := hexutil.Decode(data.Get("payload").(string))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid hex 'payload' value: %v", err)
+	}
+	if len(digest) != 32 {
+		return nil, fmt.Errorf("'payload' must be a 32-byte digest")
+	}
+	sig, err := decodeSignature(data.Get("signature").(string), data.Get("format").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := b.retrieveAccountRaw(ctx, req, name)
+	if err != nil {
+		b.Logger().Error("Failed to retrieve the account", "address", name, "error", err)
+		return nil, fmt.Errorf("Error retrieving account %s", name)
+	}
+	if account == nil {
+		return nil, fmt.Errorf("Account %s does not exist", name)
+	}
+	pub, err := parseAccountPublicKey(account)
+	if err != nil {
+		b.Logger().Error("Failed to parse the account public key", "error", err)
+		return nil, err
+	}
+
+	var valid bool
+	switch scheme := data.Get("scheme").(string); scheme {
+	case SchemeECDSA:
+		parsed, _, _, err := decodeECDSASignature(sig)
+		if err != nil {
+			return nil, err
+		}
+		valid = parsed.Verify(digest, pub)
+	case SchemeSchnorr:
+		parsed, err := schnorr.ParseSignature(sig)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid Schnorr signature: %v", err)
+		}
+		if account.TaprootInternalKey != "" && data.Get("taprootTweak").(bool) {
+			pub = txscript.ComputeTaprootKeyNoScript(pub)
+		}
+		valid = parsed.Verify(digest, pub)
+	default:
+		return nil, fmt.Errorf("Unsupported signature scheme %s", scheme)
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"valid": valid,
+		},
+	}, nil
+}
+
+func (b *backend) recoverPublicKey(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	digest, err := hexutil.Decode(data.Get("payload").(string))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid hex 'payload' value: %v", err)
+	}
+	if len(digest) != 32 {
+		return nil, fmt.Errorf("'payload' must be a 32-byte digest")
+	}
+	sig, err := decodeSignature(data.Get("signature").(string), data.Get("format").(string))
+	if err != nil {
+		return nil, err
+	}
+	_, rs, recoveryId, err := decodeECDSASignature(sig)
+	if err != nil {
+		return nil, err
+	}
+	if recoveryId < 0 {
+		return nil, fmt.Errorf("Public key recovery requires a [R || S || V] signature")
+	}
+
+	recovered, err := crypto.SigToPub(digest, append(append([]byte{}, rs...), byte(recoveryId)))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to recover the public key: %v", err)
+	}
+	pub, err := btcec.ParsePubKey(crypto.FromECDSAPub(recovered))
+	if err != nil {
+		return nil, err
+	}
+	addresses, err := allAddresses(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"publicKey":           hexutil.Encode(pub.SerializeUncompressed())[4:],
+			"compressedPublicKey": hexutil.Encode(pub.SerializeCompressed())[2:],
+			"xOnlyPublicKey":      hexutil.Encode(schnorr.SerializePubKey(pub))[2:],
+			"addresses":           addresses,
+		},
+	}, nil
+}
+
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,403 @@
+package backend
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchnorrSign(t *testing.T) {
+	assert := assert.New(t)
+
+	b, _ := getBackend(t)
+
+	// test vector 1 from BIP-340
+	req := logical.TestRequest(t, logical.UpdateOperation, "accounts")
+	storage := req.Storage
+	req.Data = map[string]interface{}{
+		"privateKey": "B7E151628AED2A6ABF7158809CF4F3C762E7160F38B4DA56A784D9045190CFEF",
+	}
+	res, err := b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	address := res.Data["address"].(string)
+
+	req = logical.TestRequest(t, logical.ReadOperation, "accounts/"+address)
+	req.Storage = storage
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	xOnlyPublicKey := res.Data["xOnlyPublicKey"].(string)
+	assert.Equal("dff1d77f2a671c5f36183726db2341be58feae1da2deced843240f7b502ba659", xOnlyPublicKey)
+
+	req = logical.TestRequest(t, logical.CreateOperation, "accounts/"+address+"/signRaw")
+	req.Storage = storage
+	req.Data = map[string]interface{}{
+		"payload": "0x243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89",
+		"scheme":  "schnorr",
+		"auxRand": "0x0000000000000000000000000000000000000000000000000000000000000001",
+	}
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	assert.Equal("0x6896bd60eeae296db48a229ff71dfe071bde413e6d43f917dc8dcf8c78de33418906d11ac976abccb20b091292bff4ea897efcb639ea871cfa95f6de339e4b0a", res.Data["signature"].(string))
+
+	// fresh aux randomness still produces a valid signature
+	delete(req.Data, "auxRand")
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	sigBytes, _ := hexutil.Decode(res.Data["signature"].(string))
+	sig, err := schnorr.ParseSignature(sigBytes)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	pubKeyBytes, _ := hexutil.Decode("0x" + xOnlyPublicKey)
+	pubKey, _ := schnorr.ParsePubKey(pubKeyBytes)
+	digest, _ := hexutil.Decode("0x243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89")
+	assert.True(sig.Verify(digest, pubKey))
+
+	req.Data["auxRand"] = "0x01"
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.Equal("'auxRand' must be a 32-byte hex string", err.Error())
+
+	req.Data["scheme"] = "eddsa"
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.Equal("Unsupported signature scheme eddsa", err.Error())
+}
+
+func TestSignRawEncodings(t *testing.T) {
+	assert := assert.New(t)
+
+	b, _ := getBackend(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "accounts")
+	storage := req.Storage
+	req.Data = map[string]interface{}{
+		"privateKey": "ec85999367d32fbbe02dd600a2a44550b95274cc67d14375a9f0bce233f13ad2",
+	}
+	res, err := b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	address := res.Data["address"].(string)
+
+	payload := "0x4fb2c4ad8c3e2a3ea9d16bd0e2e6aefa4b6d8df8a47f4fc5a1e6d1a0fb5b02c2"
+	req = logical.TestRequest(t, logical.CreateOperation, "accounts/"+address+"/signRaw")
+	req.Storage = storage
+	req.Data = map[string]interface{}{
+		"payload": payload,
+	}
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	recoverable, _ := hexutil.Decode(res.Data["signature"].(string))
+	assert.Equal(65, len(recoverable))
+	r := res.Data["r"].(string)
+	s := res.Data["s"].(string)
+	assert.Equal(hexutil.Encode(recoverable[:32]), r)
+	assert.Equal(hexutil.Encode(recoverable[32:64]), s)
+	recoveryId := recoverable[64]
+	assert.Equal(hexutil.EncodeUint64(uint64(recoveryId)), res.Data["v"].(string))
+
+	digest, _ := hexutil.Decode(payload)
+	pub, err := crypto.SigToPub(digest, recoverable)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	assert.Equal(address, strings.ToLower(crypto.PubkeyToAddress(*pub).Hex()))
+
+	req.Data["encoding"] = "eth"
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	sig, _ := hexutil.Decode(res.Data["signature"].(string))
+	assert.Equal(recoverable[:64], sig[:64])
+	assert.Equal(recoveryId+27, sig[64])
+	assert.Equal(hexutil.EncodeUint64(uint64(recoveryId+27)), res.Data["v"].(string))
+
+	req.Data["encoding"] = "eip155"
+	req.Data["chainId"] = "1337"
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	v := uint64(1337*2 + 35 + uint64(recoveryId))
+	sig, _ = hexutil.Decode(res.Data["signature"].(string))
+	assert.Equal(recoverable[:64], sig[:64])
+	assert.Equal(new(big.Int).SetUint64(v).Bytes(), sig[64:])
+	assert.Equal(hexutil.EncodeUint64(v), res.Data["v"].(string))
+
+	req.Data["encoding"] = "compact"
+	req.Data["format"] = "base64"
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	assert.Equal(base64.StdEncoding.EncodeToString(recoverable[:64]), res.Data["signature"].(string))
+
+	req.Data["encoding"] = "der"
+	req.Data["format"] = "hex"
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	der, _ := hexutil.Decode(res.Data["signature"].(string))
+	parsed, err := ecdsa.ParseDERSignature(der)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	btcPub, _ := btcec.ParsePubKey(crypto.FromECDSAPub(pub))
+	assert.True(parsed.Verify(digest, btcPub))
+	assert.Equal(r, res.Data["r"].(string))
+	assert.Equal(s, res.Data["s"].(string))
+
+	req.Data["encoding"] = "eip155"
+	req.Data["chainId"] = "0"
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.Equal("'chainId' is required for the eip155 encoding", err.Error())
+
+	req.Data["encoding"] = "pem"
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.Equal("Unsupported signature encoding pem", err.Error())
+
+	req.Data["encoding"] = "der"
+	req.Data["scheme"] = "schnorr"
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.Equal("Signature encoding der is not supported by the schnorr scheme", err.Error())
+
+	req.Data["encoding"] = "compact"
+	req.Data["format"] = "base58"
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.Equal("Unsupported signature format base58", err.Error())
+}
+
+func TestVerifySignature(t *testing.T) {
+	assert := assert.New(t)
+
+	b, storage := getBackend(t)
+
+	res, err := createAccountWithType(t, b, storage, "41f41d69260df4cf277826a9b65a3717e4eeddbeedf637f212ca096576479361", "P2TR")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	address := res.Data["address"].(string)
+
+	payload := "0x4fb2c4ad8c3e2a3ea9d16bd0e2e6aefa4b6d8df8a47f4fc5a1e6d1a0fb5b02c2"
+	signReq := logical.TestRequest(t, logical.CreateOperation, "accounts/"+address+"/signRaw")
+	signReq.Storage = storage
+	verifyReq := logical.TestRequest(t, logical.CreateOperation, "accounts/"+address+"/verify")
+	verifyReq.Storage = storage
+
+	for _, signData := range []map[string]interface{}{
+		{"encoding": "recoverable"},
+		{"encoding": "eth"},
+		{"encoding": "eip155", "chainId": "1"},
+		{"encoding": "compact", "format": "base64"},
+		{"encoding": "der"},
+		{"scheme": "schnorr"},
+		{"scheme": "schnorr", "taprootTweak": false},
+	} {
+		signData["payload"] = payload
+		signReq.Data = signData
+		res, err = b.HandleRequest(context.Background(), signReq)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		verifyReq.Data = map[string]interface{}{
+			"payload":   payload,
+			"signature": res.Data["signature"].(string),
+		}
+		for _, field := range []string{"scheme", "format", "taprootTweak"} {
+			if value, ok := signData[field]; ok {
+				verifyReq.Data[field] = value
+			}
+		}
+		res, err = b.HandleRequest(context.Background(), verifyReq)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		assert.True(res.Data["valid"].(bool), "%v", signData)
+
+		// the signature does not match another digest
+		verifyReq.Data["payload"] = "0x" + strings.Repeat("00", 32)
+		res, err = b.HandleRequest(context.Background(), verifyReq)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		assert.False(res.Data["valid"].(bool), "%v", signData)
+	}
+
+	verifyReq.Data = map[string]interface{}{
+		"payload":   payload,
+		"signature": "0x1234",
+	}
+	_, err = b.HandleRequest(context.Background(), verifyReq)
+	assert.Equal("Invalid signature length 2", err.Error())
+
+	verifyReq.Data["signature"] = "0x" + strings.Repeat("ff", 64)
+	_, err = b.HandleRequest(context.Background(), verifyReq)
+	assert.Equal("Invalid signature, R and S must be in the range [1, N-1]", err.Error())
+
+	verifyReq.Data["payload"] = "0x616263"
+	_, err = b.HandleRequest(context.Background(), verifyReq)
+	assert.Equal("'payload' must be a 32-byte digest", err.Error())
+
+	// an eip155 signature with a 2-byte V is 66 bytes long, and is not DER even when R starts
+	// with the SEQUENCE tag 0x30
+	privateKey, _ := crypto.HexToECDSA("41f41d69260df4cf277826a9b65a3717e4eeddbeedf637f212ca096576479361")
+	var digest, sig []byte
+	for i := 0; len(sig) == 0 || sig[0] != 0x30; i++ {
+		hash := sha256.Sum256([]byte{byte(i), byte(i >> 8)})
+		digest = hash[:]
+		sig, _ = crypto.Sign(digest, privateKey)
+	}
+	v := big.NewInt(1337*2 + 35 + int64(sig[64]))
+	eip155 := append(append([]byte{}, sig[:64]...), v.Bytes()...)
+	assert.Equal(66, len(eip155))
+	verifyReq.Data = map[string]interface{}{
+		"payload":   hexutil.Encode(digest),
+		"signature": hexutil.Encode(eip155),
+	}
+	res, err = b.HandleRequest(context.Background(), verifyReq)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	assert.True(res.Data["valid"].(bool))
+	recoverReq := logical.TestRequest(t, logical.UpdateOperation, "recover")
+	recoverReq.Storage = storage
+	recoverReq.Data = verifyReq.Data
+	res, err = b.HandleRequest(context.Background(), recoverReq)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	assert.Equal(hexutil.Encode(crypto.CompressPubkey(&privateKey.PublicKey))[2:], res.Data["compressedPublicKey"].(string))
+}
+
+func TestRecoverPublicKey(t *testing.T) {
+	assert := assert.New(t)
+
+	b, storage := getBackend(t)
+
+	// the public key of private key 1 is the generator point
+	res, err := createAccountWithType(t, b, storage, "0000000000000000000000000000000000000000000000000000000000000001", "ETH")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	address := res.Data["address"].(string)
+	assert.Equal("0x7e5f4552091a69125d5dfcb7b8c2659029395bdf", address)
+
+	payload := "0x4fb2c4ad8c3e2a3ea9d16bd0e2e6aefa4b6d8df8a47f4fc5a1e6d1a0fb5b02c2"
+	req := logical.TestRequest(t, logical.CreateOperation, "accounts/"+address+"/signRaw")
+	req.Storage = storage
+	req.Data = map[string]interface{}{
+		"payload":  payload,
+		"encoding": "eip155",
+		"chainId":  "1337",
+	}
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "recover")
+	req.Storage = storage
+	req.Data = map[string]interface{}{
+		"payload":   payload,
+		"signature": res.Data["signature"].(string),
+	}
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	assert.Equal("0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798", res.Data["compressedPublicKey"].(string))
+	assert.Equal("79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798", res.Data["xOnlyPublicKey"].(string))
+	addresses := res.Data["addresses"].(map[string]interface{})
+	assert.Equal(address, addresses["ETH"])
+	assert.Equal("bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", addresses["P2WPKH"])
+	assert.Equal("bcrt1qw508d6qejxtdg4y5r3zarvary0c5xw7kygt080", addresses["P2WPKH-Regtest"])
+	assert.Equal("cosmos1w508d6qejxtdg4y5r3zarvary0c5xw7k6ah60c", addresses["COSMOS"])
+	assert.Equal("qp63uahgrxged4z5jswyt5dn5v3lzsem6cy4spdc2h", addresses["BCH"])
+	assert.Equal("rBgGZ9tc4him9KBzD8fKFiQz3fSZpaSwMH", addresses["XRPL"])
+	assert.Equal(len(bitcoinAddressTypes)+5, len(addresses))
+
+	req.Data["signature"] = req.Data["signature"].(string)[:130]
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.Equal("Public key recovery requires a [R || S || V] signature", err.Error())
+
+	req.Data["payload"] = "0x1234"
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.Equal("'payload' must be a 32-byte digest", err.Error())
+}
+
+func TestSignRawHash(t *testing.T) {
+	assert := assert.New(t)
+
+	b, storage := getBackend(t)
+
+	res, err := createAccountWithType(t, b, storage, "ec85999367d32fbbe02dd600a2a44550b95274cc67d14375a9f0bce233f13ad2", "ETH")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	address := res.Data["address"].(string)
+
+	req := logical.TestRequest(t, logical.CreateOperation, "accounts/"+address+"/signRaw")
+	req.Storage = storage
+	preimage := hexutil.Encode([]byte("abc"))
+	for hash, expected := range map[string]string{
+		"keccak256":     "0x4e03657aea45a94fc7d47ba826c8d667c0d1e6e33a64a036ec44f58fa12d6c45",
+		"sha256":        "0xba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+		"double-sha256": "0x4f8b42c22dd3729b519ba6f68d2da7cc5b2d606d05daed5ad5128cc03e6c6358",
+		"sha512/256":    "0x53048e2681941ef99b2e29b76b4c7dabe4c2d0c634fc6d46e0e2f13107e7af23",
+		"blake2b-256":   "0xbddd813c634239723171ef3fee98579b94964e3bb1cb3e427262c8c068d52319",
+	} {
+		req.Data = map[string]interface{}{
+			"payload": preimage,
+			"hash":    hash,
+		}
+		res, err = b.HandleRequest(context.Background(), req)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		assert.Equal(expected, res.Data["digest"].(string), hash)
+
+		sig, _ := hexutil.Decode(res.Data["signature"].(string))
+		digest, _ := hexutil.Decode(expected)
+		pub, err := crypto.SigToPub(digest, sig)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		assert.Equal(address, strings.ToLower(crypto.PubkeyToAddress(*pub).Hex()), hash)
+	}
+
+	req.Data = map[string]interface{}{
+		"payload": preimage,
+	}
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.Equal("'payload' must be a 32-byte digest when 'hash' is none, got 3 bytes", err.Error())
+
+	req.Data["scheme"] = "schnorr"
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.Equal("'payload' must be a 32-byte digest when 'hash' is none, got 3 bytes", err.Error())
+
+	req.Data["hash"] = "md5"
+	_, err = b.HandleRequest(context.Background(), req)
+	assert.Equal("Unsupported 'hash' value md5", err.Error())
+}
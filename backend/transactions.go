@@ -0,0 +1,334 @@
+// Copyright © 2020 Kaleido
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto/kzg4844"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/holiman/uint256"
+)
+
+// txParams holds the fields shared by all the supported transaction types
+type txParams struct {
+	chainId  *big.Int
+	nonce    uint64
+	to       *common.Address
+	value    *big.Int
+	gasLimit uint64
+	data     []byte
+}
+
+// buildTransaction assembles an unsigned transaction of the requested type and
+// returns it together with the signer that must be used to sign it
+func buildTransaction(txType uint64, params *txParams, data *framework.FieldData) (*types.Transaction, types.Signer, error) {
+	switch txType {
+	case types.LegacyTxType:
+		if data.Get("accessList").(string) != "" {
+			return nil, nil, fmt.Errorf("'accessList' is not supported by legacy transactions, use type 1 or 2")
+		}
+		gasPrice := ValidNumber(data.Get("gasPrice").(string))
+		if gasPrice == nil {
+			return nil, nil, fmt.Errorf("Invalid 'gasPrice' value")
+		}
+		tx := types.NewTx(&types.LegacyTx{
+			Nonce:    params.nonce,
+			GasPrice: gasPrice,
+			Gas:      params.gasLimit,
+			To:       params.to,
+			Value:    params.value,
+			Data:     params.data,
+		})
+		if big.NewInt(0).Cmp(params.chainId) == 0 {
+			return tx, types.HomesteadSigner{}, nil
+		}
+		return tx, types.NewEIP155Signer(params.chainId), nil
+
+	case types.AccessListTxType:
+		if big.NewInt(0).Cmp(params.chainId) == 0 {
+			return nil, nil, fmt.Errorf("'chainId' is required for typed transactions")
+		}
+		gasPrice := ValidNumber(data.Get("gasPrice").(string))
+		if gasPrice == nil {
+			return nil, nil, fmt.Errorf("Invalid 'gasPrice' value")
+		}
+		accessList, err := parseAccessList(data.Get("accessList").(string))
+		if err != nil {
+			return nil, nil, err
+		}
+		tx := types.NewTx(&types.AccessListTx{
+			ChainID:    params.chainId,
+			Nonce:      params.nonce,
+			GasPrice:   gasPrice,
+			Gas:        params.gasLimit,
+			To:         params.to,
+			Value:      params.value,
+			Data:       params.data,
+			AccessList: accessList,
+		})
+		return tx, types.NewEIP2930Signer(params.chainId), nil
+
+	case types.DynamicFeeTxType:
+		if big.NewInt(0).Cmp(params.chainId) == 0 {
+			return nil, nil, fmt.Errorf("'chainId' is required for typed transactions")
+		}
+		gasTipCap, gasFeeCap, err := parseFeeCaps(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		accessList, err := parseAccessList(data.Get("accessList").(string))
+		if err != nil {
+			return nil, nil, err
+		}
+		tx := types.NewTx(&types.DynamicFeeTx{
+			ChainID:    params.chainId,
+			Nonce:      params.nonce,
+			GasTipCap:  gasTipCap,
+			GasFeeCap:  gasFeeCap,
+			Gas:        params.gasLimit,
+			To:         params.to,
+			Value:      params.value,
+			Data:       params.data,
+			AccessList: accessList,
+		})
+		return tx, types.NewLondonSigner(params.chainId), nil
+
+	case types.BlobTxType:
+		if big.NewInt(0).Cmp(params.chainId) == 0 {
+			return nil, nil, fmt.Errorf("'chainId' is required for typed transactions")
+		}
+		if params.to == nil {
+			return nil, nil, fmt.Errorf("'to' is required for blob transactions")
+		}
+		gasTipCap, gasFeeCap, err := parseFeeCaps(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		blobFeeCap := ValidNumber(data.Get("maxFeePerBlobGas").(string))
+		if blobFeeCap == nil {
+			return nil, nil, fmt.Errorf("Invalid 'maxFeePerBlobGas' value")
+		}
+		accessList, err := parseAccessList(data.Get("accessList").(string))
+		if err != nil {
+			return nil, nil, err
+		}
+		blobHashes, sidecar, err := parseBlobs(data.Get("blobVersionedHashes").([]string), data.Get("blobs").([]string))
+		if err != nil {
+			return nil, nil, err
+		}
+		blobTx := &types.BlobTx{
+			Nonce:      params.nonce,
+			Gas:        params.gasLimit,
+			To:         *params.to,
+			Data:       params.data,
+			AccessList: accessList,
+			BlobHashes: blobHashes,
+			Sidecar:    sidecar,
+		}
+		err = assignUint256(
+			uint256Field{"chainId", params.chainId, &blobTx.ChainID},
+			uint256Field{"value", params.value, &blobTx.Value},
+			uint256Field{"maxPriorityFeePerGas", gasTipCap, &blobTx.GasTipCap},
+			uint256Field{"maxFeePerGas", gasFeeCap, &blobTx.GasFeeCap},
+			uint256Field{"maxFeePerBlobGas", blobFeeCap, &blobTx.BlobFeeCap},
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		return types.NewTx(blobTx), types.NewCancunSigner(params.chainId), nil
+
+	case types.SetCodeTxType:
+		if big.NewInt(0).Cmp(params.chainId) == 0 {
+			return nil, nil, fmt.Errorf("'chainId' is required for typed transactions")
+		}
+		if params.to == nil {
+			return nil, nil, fmt.Errorf("'to' is required for set code transactions")
+		}
+		gasTipCap, gasFeeCap, err := parseFeeCaps(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		accessList, err := parseAccessList(data.Get("accessList").(string))
+		if err != nil {
+			return nil, nil, err
+		}
+		authList, err := parseAuthorizationList(data.Get("authorizationList").(string))
+		if err != nil {
+			return nil, nil, err
+		}
+		setCodeTx := &types.SetCodeTx{
+			Nonce:      params.nonce,
+			Gas:        params.gasLimit,
+			To:         *params.to,
+			Data:       params.data,
+			AccessList: accessList,
+			AuthList:   authList,
+		}
+		err = assignUint256(
+			uint256Field{"chainId", params.chainId, &setCodeTx.ChainID},
+			uint256Field{"value", params.value, &setCodeTx.Value},
+			uint256Field{"maxPriorityFeePerGas", gasTipCap, &setCodeTx.GasTipCap},
+			uint256Field{"maxFeePerGas", gasFeeCap, &setCodeTx.GasFeeCap},
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		return types.NewTx(setCodeTx), types.NewPragueSigner(params.chainId), nil
+
+	default:
+		return nil, nil, fmt.Errorf("Unsupported transaction type %d", txType)
+	}
+}
+
+// parseFeeCaps reads the EIP-1559 'maxPriorityFeePerGas' and 'maxFeePerGas' fields
+func parseFeeCaps(data *framework.FieldData) (*big.Int, *big.Int, error) {
+	gasTipCap := ValidNumber(data.Get("maxPriorityFeePerGas").(string))
+	if gasTipCap == nil {
+		return nil, nil, fmt.Errorf("Invalid 'maxPriorityFeePerGas' value")
+	}
+	gasFeeCap := ValidNumber(data.Get("maxFeePerGas").(string))
+	if gasFeeCap == nil {
+		return nil, nil, fmt.Errorf("Invalid 'maxFeePerGas' value")
+	}
+	if gasFeeCap.Cmp(gasTipCap) < 0 {
+		return nil, nil, fmt.Errorf("'maxFeePerGas' must not be lower than 'maxPriorityFeePerGas'")
+	}
+	return gasTipCap, gasFeeCap, nil
+}
+
+// uint256Field describes a validated big integer field to be stored in a uint256 based transaction
+type uint256Field struct {
+	name  string
+	value *big.Int
+	dest  **uint256.Int
+}
+
+// assignUint256 converts the given fields, blob and set code transactions use uint256 instead of big.Int
+func assignUint256(fields ...uint256Field) error {
+	for _, field := range fields {
+		v, overflow := uint256.FromBig(field.value)
+		if overflow {
+			return fmt.Errorf("'%s' value is too large", field.name)
+		}
+		*field.dest = v
+	}
+	return nil
+}
+
+// parseAuthorizationList decodes the JSON encoded EIP-7702 'authorizationList' field, as returned
+// by the sign-authorization endpoint. A set code transaction must carry at least one authorization.
+func parseAuthorizationList(input string) ([]types.SetCodeAuthorization, error) {
+	if input == "" {
+		return nil, fmt.Errorf("Set code transactions require a non-empty 'authorizationList'")
+	}
+	var authList []types.SetCodeAuthorization
+	if err := json.Unmarshal([]byte(input), &authList); err != nil {
+		return nil, fmt.Errorf("Invalid 'authorizationList' value: %v", err)
+	}
+	if len(authList) == 0 {
+		return nil, fmt.Errorf("Set code transactions require a non-empty 'authorizationList'")
+	}
+	return authList, nil
+}
+
+// parseAccessList decodes the JSON encoded 'accessList' field, an empty input means no access list.
+// Every entry must match the go-ethereum types.AccessTuple structure exactly, unknown keys are rejected.
+func parseAccessList(input string) (types.AccessList, error) {
+	if input == "" {
+		return nil, nil
+	}
+	var entries []json.RawMessage
+	if err := json.Unmarshal([]byte(input), &entries); err != nil {
+		return nil, fmt.Errorf("Invalid 'accessList' value: must be a JSON array of {\"address\", \"storageKeys\"} objects")
+	}
+	accessList := make(types.AccessList, 0, len(entries))
+	for i, entry := range entries {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(entry, &fields); err != nil || fields == nil {
+			return nil, fmt.Errorf("Invalid 'accessList' value: entry %d is not a JSON object", i)
+		}
+		for key := range fields {
+			if key != "address" && key != "storageKeys" {
+				return nil, fmt.Errorf("Invalid 'accessList' value: entry %d has unknown field '%s'", i, key)
+			}
+		}
+		var tuple types.AccessTuple
+		if err := json.Unmarshal(entry, &tuple); err != nil {
+			return nil, fmt.Errorf("Invalid 'accessList' value: entry %d: %v", i, err)
+		}
+		accessList = append(accessList, tuple)
+	}
+	return accessList, nil
+}
+
+// parseBlobs validates the EIP-4844 versioned hashes and, when raw blobs are provided, computes
+// their KZG commitments and proofs. The versioned hashes are derived from the blobs if omitted,
+// otherwise they must match the blobs one for one.
+func parseBlobs(hashesInput []string, blobsInput []string) ([]common.Hash, *types.BlobTxSidecar, error) {
+	var hashes []common.Hash
+	for i, h := range hashesInput {
+		decoded, err := hexutil.Decode(h)
+		if err != nil || !kzg4844.IsValidVersionedHash(decoded) {
+			return nil, nil, fmt.Errorf("Invalid 'blobVersionedHashes' value at index %d", i)
+		}
+		hashes = append(hashes, common.BytesToHash(decoded))
+	}
+	if len(blobsInput) == 0 {
+		if len(hashes) == 0 {
+			return nil, nil, fmt.Errorf("Blob transactions require 'blobVersionedHashes' or 'blobs'")
+		}
+		return hashes, nil, nil
+	}
+
+	sidecar := &types.BlobTxSidecar{}
+	for i, b := range blobsInput {
+		decoded, err := hexutil.Decode(b)
+		if err != nil || len(decoded) != len(kzg4844.Blob{}) {
+			return nil, nil, fmt.Errorf("Invalid 'blobs' value at index %d, each blob must be %d bytes", i, len(kzg4844.Blob{}))
+		}
+		var blob kzg4844.Blob
+		copy(blob[:], decoded)
+		commitment, err := kzg4844.BlobToCommitment(&blob)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to compute the KZG commitment for blob %d: %v", i, err)
+		}
+		proof, err := kzg4844.ComputeBlobProof(&blob, commitment)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to compute the KZG proof for blob %d: %v", i, err)
+		}
+		sidecar.Blobs = append(sidecar.Blobs, blob)
+		sidecar.Commitments = append(sidecar.Commitments, commitment)
+		sidecar.Proofs = append(sidecar.Proofs, proof)
+	}
+
+	computed := sidecar.BlobHashes()
+	if len(hashes) > 0 {
+		if len(hashes) != len(computed) {
+			return nil, nil, fmt.Errorf("'blobVersionedHashes' count does not match the number of 'blobs'")
+		}
+		for i := range hashes {
+			if hashes[i] != computed[i] {
+				return nil, nil, fmt.Errorf("'blobVersionedHashes' value at index %d does not match the blob commitment", i)
+			}
+		}
+	}
+	return computed, sidecar, nil
+}
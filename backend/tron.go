@@ -0,0 +1,149 @@
+// Copyright © 2020 Kaleido
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// field numbers of the Tron protocol.Transaction message
+const (
+	tronRawDataField   protowire.Number = 1
+	tronSignatureField protowire.Number = 2
+)
+
+func (b *backend) signTron(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	from := data.Get("name").(string)
+
+	sign, err := b.prepareSignTron(data)
+	if err != nil {
+		return nil, err
+	}
+	return b.signWithAccount(ctx, req, from, sign)
+}
+
+func (b *backend) prepareSignTron(data *framework.FieldData) (signFunc, error) {
+	input := strings.TrimSpace(data.Get("transaction").(string))
+
+	// the transaction is either the raw_data protobuf hex, or the JSON returned by TronGrid
+	var tx map[string]interface{}
+	var rawDataHex string
+	if strings.HasPrefix(input, "{") {
+		decoder := json.NewDecoder(strings.NewReader(input))
+		decoder.UseNumber()
+		if err := decoder.Decode(&tx); err != nil {
+			b.Logger().Error("Failed to decode the Tron transaction", "error", err)
+			return nil, fmt.Errorf("Invalid 'transaction' value: %v", err)
+		}
+		rawDataHex, _ = tx["raw_data_hex"].(string)
+		if rawDataHex == "" {
+			return nil, fmt.Errorf("'transaction' JSON must have a 'raw_data_hex' value")
+		}
+	} else {
+		rawDataHex = input
+	}
+
+	rawData, err := hex.DecodeString(strings.TrimPrefix(rawDataHex, "0x"))
+	if err != nil || len(rawData) == 0 {
+		return nil, fmt.Errorf("Invalid raw data hex, it must be a non-empty hexidecimal string")
+	}
+	if err := validateProtobuf(rawData); err != nil {
+		return nil, fmt.Errorf("Invalid raw data, it is not a protobuf message: %v", err)
+	}
+
+	txHash := sha256.Sum256(rawData)
+	txID := hex.EncodeToString(txHash[:])
+	if tx != nil {
+		if id, ok := tx["txID"].(string); ok && id != "" && !strings.EqualFold(id, txID) {
+			return nil, fmt.Errorf("'txID' %s does not match the hash %s of the raw data", id, txID)
+		}
+	}
+
+	// signatures already attached to the transaction are kept, for multi-signature permissions
+	var signatures []string
+	if tx != nil && tx["signature"] != nil {
+		existing, ok := tx["signature"].([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("'signature' of the transaction must be an array of hex strings")
+		}
+		for _, s := range existing {
+			sig, ok := s.(string)
+			if _, err := hex.DecodeString(sig); !ok || err != nil {
+				return nil, fmt.Errorf("'signature' of the transaction must be an array of hex strings")
+			}
+			signatures = append(signatures, sig)
+		}
+	}
+
+	return func(account *Account, privateKey *ecdsa.PrivateKey) (map[string]interface{}, error) {
+		sig, err := crypto.Sign(txHash[:], privateKey)
+		if err != nil {
+			b.Logger().Error("Failed to sign the Tron transaction", "error", err)
+			return nil, err
+		}
+		// TronWeb returns v in the 27/28 form
+		sig[crypto.RecoveryIDOffset] += 27
+		signature := hex.EncodeToString(sig)
+		allSignatures := append(append([]string{}, signatures...), signature)
+
+		signedTx := protowire.AppendTag(nil, tronRawDataField, protowire.BytesType)
+		signedTx = protowire.AppendBytes(signedTx, rawData)
+		for _, s := range allSignatures {
+			sigBytes, _ := hex.DecodeString(s)
+			signedTx = protowire.AppendTag(signedTx, tronSignatureField, protowire.BytesType)
+			signedTx = protowire.AppendBytes(signedTx, sigBytes)
+		}
+
+		result := map[string]interface{}{
+			"transaction_hash":   txID,
+			"signature":          signature,
+			"signed_transaction": hex.EncodeToString(signedTx),
+		}
+		if tx != nil {
+			tx["txID"] = txID
+			tx["signature"] = allSignatures
+			result["transaction"] = tx
+		}
+		return result, nil
+	}, nil
+}
+
+// validateProtobuf checks that the bytes are a well formed protobuf message
+func validateProtobuf(message []byte) error {
+	for len(message) > 0 {
+		number, wireType, n := protowire.ConsumeTag(message)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		message = message[n:]
+		n = protowire.ConsumeFieldValue(number, wireType, message)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		message = message[n:]
+	}
+	return nil
+}
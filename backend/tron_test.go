@@ -0,0 +1,111 @@
+package backend
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/okx/go-wallet-sdk/coins/tron"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestSignTron(t *testing.T) {
+	assert := assert.New(t)
+
+	b, storage := getBackend(t)
+
+	res, err := createAccountWithType(t, b, storage, "ec85999367d32fbbe02dd600a2a44550b95274cc67d14375a9f0bce233f13ad2", "TRON")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	address := res.Data["address"].(string)
+
+	// ref_block_bytes, ref_block_hash, expiration and timestamp of a raw_data message
+	rawData := protowire.AppendTag(nil, 1, protowire.BytesType)
+	rawData = protowire.AppendBytes(rawData, []byte{0x3c, 0x8e})
+	rawData = protowire.AppendTag(rawData, 4, protowire.BytesType)
+	rawData = protowire.AppendBytes(rawData, []byte{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0})
+	rawData = protowire.AppendTag(rawData, 8, protowire.VarintType)
+	rawData = protowire.AppendVarint(rawData, 1700000060000)
+	rawData = protowire.AppendTag(rawData, 14, protowire.VarintType)
+	rawData = protowire.AppendVarint(rawData, 1700000000000)
+	rawDataHex := hex.EncodeToString(rawData)
+	txHash := sha256.Sum256(rawData)
+	txID := hex.EncodeToString(txHash[:])
+
+	req := logical.TestRequest(t, logical.CreateOperation, "accounts/"+address+"/sign-tron")
+	req.Storage = storage
+	req.Data = map[string]interface{}{
+		"transaction": rawDataHex,
+	}
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	assert.Equal(txID, res.Data["transaction_hash"].(string))
+	assert.Nil(res.Data["transaction"])
+
+	// the signature recovers to the account address, with v as 27/28
+	signature, _ := hex.DecodeString(res.Data["signature"].(string))
+	assert.Equal(65, len(signature))
+	assert.True(signature[64] == 27 || signature[64] == 28)
+	recoverable := append([]byte{}, signature...)
+	recoverable[64] -= 27
+	pub, err := crypto.SigToPub(txHash[:], recoverable)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	pubKey, _ := btcec.ParsePubKey(crypto.FromECDSAPub(pub))
+	assert.Equal(address, tron.GetAddress(pubKey))
+
+	// the signed transaction is the Transaction message with the raw data and the signature
+	signedTx := protowire.AppendTag(nil, 1, protowire.BytesType)
+	signedTx = protowire.AppendBytes(signedTx, rawData)
+	signedTx = protowire.AppendTag(signedTx, 2, protowire.BytesType)
+	signedTx = protowire.AppendBytes(signedTx, signature)
+	assert.Equal(hex.EncodeToString(signedTx), res.Data["signed_transaction"].(string))
+
+	// the TronGrid JSON form keeps the existing signatures and the other fields
+	existing := hex.EncodeToString(make([]byte, 65))
+	req.Data = map[string]interface{}{
+		"transaction": fmt.Sprintf(`{"visible":false,"txID":"%s","raw_data":{"expiration":1700000060000,"timestamp":1700000000000},"raw_data_hex":"%s","signature":["%s"]}`, txID, rawDataHex, existing),
+	}
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	tx := res.Data["transaction"].(map[string]interface{})
+	assert.Equal([]string{existing, hex.EncodeToString(signature)}, tx["signature"])
+	assert.Equal(txID, tx["txID"])
+	assert.Equal(json.Number("1700000060000"), tx["raw_data"].(map[string]interface{})["expiration"])
+	multiSigned := protowire.AppendTag(nil, 1, protowire.BytesType)
+	multiSigned = protowire.AppendBytes(multiSigned, rawData)
+	multiSigned = protowire.AppendTag(multiSigned, 2, protowire.BytesType)
+	multiSigned = protowire.AppendBytes(multiSigned, make([]byte, 65))
+	multiSigned = protowire.AppendTag(multiSigned, 2, protowire.BytesType)
+	multiSigned = protowire.AppendBytes(multiSigned, signature)
+	assert.Equal(hex.EncodeToString(multiSigned), res.Data["signed_transaction"].(string))
+
+	for input, expected := range map[string]string{
+		"":                                      "Invalid raw data hex, it must be a non-empty hexidecimal string",
+		"0xzz":                                  "Invalid raw data hex, it must be a non-empty hexidecimal string",
+		"0a05ab":                                "Invalid raw data, it is not a protobuf message: unexpected EOF",
+		`{"raw_data":{}}`:                       "'transaction' JSON must have a 'raw_data_hex' value",
+		`{"raw_data_hex":`:                      "Invalid 'transaction' value: unexpected EOF",
+		`{"raw_data_hex":"0a00","txID":"abcd"}`: "'txID' abcd does not match the hash 102b51b9765a56a3e899f7cf0ee38e5251f9c503b357b330a49183eb7b155604 of the raw data",
+		`{"raw_data_hex":"0a00","signature":[1]}`: "'signature' of the transaction must be an array of hex strings",
+	} {
+		req.Data = map[string]interface{}{
+			"transaction": input,
+		}
+		_, err = b.HandleRequest(context.Background(), req)
+		assert.Equal(expected, err.Error())
+	}
+}
@@ -0,0 +1,605 @@
+// Copyright © 2020 Kaleido
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/tyler-smith/go-bip39"
+)
+
+// Wallet is a BIP-32 hierarchical deterministic wallet
+type Wallet struct {
+	Name string `json:"name"`
+	// Seed is the hex encoded master seed
+	Seed string `json:"seed"`
+	// Accounts lists the addresses of the accounts derived from the wallet
+	Accounts []string `json:"accounts,omitempty"`
+}
+
+func (b *backend) listWallets(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	vals, err := req.Storage.List(ctx, "wallets/")
+	if err != nil {
+		b.Logger().Error("Failed to retrieve the list of wallets", "error", err)
+		return nil, err
+	}
+
+	return logical.ListResponse(vals), nil
+}
+
+func (b *backend) createWallet(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	seedInput := data.Get("seed").(string)
+	mnemonic := strings.Join(strings.Fields(data.Get("mnemonic").(string)), " ")
+	passphrase := data.Get("passphrase").(string)
+	words := data.Get("words").(int)
+
+	if seedInput != "" && (mnemonic != "" || words != 0) {
+		return nil, fmt.Errorf("'seed' can not be combined with 'mnemonic' or 'words'")
+	}
+	if mnemonic != "" && words != 0 {
+		return nil, fmt.Errorf("'mnemonic' can not be combined with 'words'")
+	}
+	if passphrase != "" && mnemonic == "" && words == 0 {
+		return nil, fmt.Errorf("'passphrase' is only used with 'mnemonic' or 'words'")
+	}
+
+	var seed []byte
+	var err error
+	var encryptedMnemonic string
+	switch {
+	case seedInput != "":
+		seed, err = hex.DecodeString(strings.TrimPrefix(seedInput, "0x"))
+		if err != nil || len(seed) < hdkeychain.MinSeedBytes || len(seed) > hdkeychain.MaxSeedBytes {
+			return nil, fmt.Errorf("seed must be a %d to %d byte hexidecimal string", hdkeychain.MinSeedBytes, hdkeychain.MaxSeedBytes)
+		}
+	case mnemonic != "":
+		if !bip39.IsMnemonicValid(mnemonic) {
+			return nil, fmt.Errorf("Invalid mnemonic, it must be a BIP-39 mnemonic of the English wordlist with a valid checksum")
+		}
+		seed = bip39.NewSeed(mnemonic, passphrase)
+	case words != 0:
+		mnemonic, err = generateMnemonic(words)
+		if err != nil {
+			return nil, err
+		}
+		rsaPublicKey := data.Get("rsaPublicKey").(string)
+		if rsaPublicKey == "" {
+			return nil, fmt.Errorf("'rsaPublicKey' is required to return the generated mnemonic")
+		}
+		// the mnemonic is not stored, this response is the only chance to back it up
+		encryptedMnemonic = encodeBase64(b.rsaProvider.EncryptWithPublicKey([]byte(mnemonic), []byte(rsaPublicKey)))
+		seed = bip39.NewSeed(mnemonic, passphrase)
+	default:
+		seed, err = hdkeychain.GenerateSeed(hdkeychain.RecommendedSeedLen)
+		if err != nil {
+			b.Logger().Error("Failed to generate the wallet seed", "error", err)
+			return nil, err
+		}
+	}
+	defer zeroBytes(seed)
+
+	resp, err := b.storeNewWallet(ctx, req, name, seed)
+	if err != nil {
+		return nil, err
+	}
+	if encryptedMnemonic != "" {
+		resp.Data["mnemonic"] = encryptedMnemonic
+	}
+	return resp, nil
+}
+
+// generateMnemonic returns a new BIP-39 mnemonic of the given number of words, from the
+// English wordlist
+func generateMnemonic(words int) (string, error) {
+	switch words {
+	case 12, 15, 18, 21, 24:
+	default:
+		return "", fmt.Errorf("'words' must be one of 12, 15, 18, 21 or 24, got %d", words)
+	}
+	// every 3 words encode 32 bits of entropy and 1 checksum bit
+	entropy, err := bip39.NewEntropy(words / 3 * 32)
+	if err != nil {
+		return "", err
+	}
+	defer zeroBytes(entropy)
+	return bip39.NewMnemonic(entropy)
+}
+
+// storeNewWallet saves a wallet with the given master seed and returns its description
+func (b *backend) storeNewWallet(ctx context.Context, req *logical.Request, name string, seed []byte) (*logical.Response, error) {
+	defer b.lockWallet(name)()
+	existing, err := b.retrieveWallet(ctx, req, name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("Wallet %s already exists", name)
+	}
+
+	wallet := &Wallet{
+		Name: name,
+		Seed: hex.EncodeToString(seed),
+	}
+	master, err := wallet.masterKey()
+	if err != nil {
+		b.Logger().Error("Failed to compute the wallet master key", "error", err)
+		return nil, err
+	}
+	defer master.Zero()
+
+	if err := b.saveWallet(ctx, req, wallet); err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name":              wallet.Name,
+			"masterFingerprint": masterFingerprint(master),
+		},
+	}, nil
+}
+
+func (b *backend) readWallet(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	wallet, err := b.retrieveWallet(ctx, req, name)
+	if err != nil {
+		return nil, err
+	}
+	if wallet == nil {
+		return nil, fmt.Errorf("Wallet does not exist")
+	}
+	master, err := wallet.masterKey()
+	if err != nil {
+		return nil, err
+	}
+	defer master.Zero()
+
+	accounts := wallet.Accounts
+	if accounts == nil {
+		accounts = []string{}
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name":              wallet.Name,
+			"masterFingerprint": masterFingerprint(master),
+			"accounts":          accounts,
+		},
+	}, nil
+}
+
+func (b *backend) deleteWallet(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	defer b.lockWallet(name)()
+	wallet, err := b.retrieveWallet(ctx, req, name)
+	if err != nil {
+		b.Logger().Error("Failed to retrieve the wallet by name", "name", name, "error", err)
+		return nil, err
+	}
+	if wallet == nil {
+		return nil, nil
+	}
+	// derived accounts can't sign without the wallet seed. An entry replaced by an imported key
+	// since the derivation is not the wallet's to delete.
+	for _, address := range wallet.Accounts {
+		account, err := b.retrieveAccountRaw(ctx, req, address)
+		if err != nil {
+			return nil, err
+		}
+		if account == nil || account.Wallet != wallet.Name {
+			continue
+		}
+		if err := req.Storage.Delete(ctx, fmt.Sprintf("accounts/%s", address)); err != nil {
+			b.Logger().Error("Failed to delete the derived account from storage", "address", address, "error", err)
+			return nil, err
+		}
+	}
+	if err := req.Storage.Delete(ctx, fmt.Sprintf("wallets/%s", wallet.Name)); err != nil {
+		b.Logger().Error("Failed to delete the wallet from storage", "name", name, "error", err)
+		return nil, err
+	}
+	return nil, nil
+}
+
+// coinType is the standard derivation of the accounts of a SLIP-44 coin type
+type coinType struct {
+	purpose     uint32
+	addressType string
+}
+
+// coinTypes maps the SLIP-44 coin types to their BIP-43 purpose and address type
+var coinTypes = map[int]coinType{
+	0:   {84, "P2WPKH"},
+	1:   {84, "P2WPKH-Testnet"},
+	2:   {84, "LTC-P2WPKH"},
+	3:   {44, "DOGE-P2PKH"},
+	60:  {44, AddressTypeETH},
+	118: {44, AddressTypeCOSMOS},
+	144: {44, AddressTypeXRPL},
+	145: {44, AddressTypeBCH},
+	195: {44, AddressTypeTRON},
+}
+
+func (b *backend) deriveAccount(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	path := data.Get("path").(string)
+	addressType := data.Get("addressType").(string)
+
+	if coin, ok := data.GetOk("coin"); ok {
+		if path != "" || addressType != "" {
+			return nil, fmt.Errorf("'coin' can not be combined with 'path' or 'addressType'")
+		}
+		var err error
+		path, addressType, err = coinDerivation(coin.(int), data.Get("account").(int), data.Get("change").(bool), data.Get("index").(int))
+		if err != nil {
+			return nil, err
+		}
+	} else if path == "" {
+		return nil, fmt.Errorf("Either 'path' or 'coin' is required")
+	}
+
+	defer b.lockWallet(name)()
+	wallet, err := b.retrieveWallet(ctx, req, name)
+	if err != nil {
+		return nil, err
+	}
+	if wallet == nil {
+		return nil, fmt.Errorf("Wallet %s does not exist", name)
+	}
+
+	return b.storeDerivedAccount(ctx, req, wallet, path, addressType, data.Get("hrp").(string))
+}
+
+// coinDerivation returns the BIP-44 style path m/purpose'/coin'/account'/change/index and the
+// address type of the coin
+func coinDerivation(coin int, account int, change bool, index int) (string, string, error) {
+	ct, ok := coinTypes[coin]
+	if !ok {
+		return "", "", fmt.Errorf("Unsupported 'coin' value %d", coin)
+	}
+	if account < 0 || account >= hdkeychain.HardenedKeyStart {
+		return "", "", fmt.Errorf("'account' must be between 0 and %d", hdkeychain.HardenedKeyStart-1)
+	}
+	if index < 0 || index >= hdkeychain.HardenedKeyStart {
+		return "", "", fmt.Errorf("'index' must be between 0 and %d", hdkeychain.HardenedKeyStart-1)
+	}
+	chain := 0
+	if change {
+		chain = 1
+	}
+	return fmt.Sprintf("m/%d'/%d'/%d'/%d/%d", ct.purpose, coin, account, chain, index), ct.addressType, nil
+}
+
+// SLIP-132 version bytes of the extended public keys, by BIP-43 purpose and network
+var extendedPublicKeyVersions = map[uint32]struct{ mainnet, testnet [4]byte }{
+	44: {[4]byte{0x04, 0x88, 0xb2, 0x1e}, [4]byte{0x04, 0x35, 0x87, 0xcf}}, // xpub, tpub
+	49: {[4]byte{0x04, 0x9d, 0x7c, 0xb2}, [4]byte{0x04, 0x4a, 0x52, 0x62}}, // ypub, upub
+	84: {[4]byte{0x04, 0xb2, 0x47, 0x46}, [4]byte{0x04, 0x5f, 0x1c, 0xf6}}, // zpub, vpub
+	// taproot has no SLIP-132 prefix, xpub is used along with a tr() descriptor
+	86: {[4]byte{0x04, 0x88, 0xb2, 0x1e}, [4]byte{0x04, 0x35, 0x87, 0xcf}},
+}
+
+// SLIP-132 version bytes registered for other networks, by BIP-43 purpose and coin type. The
+// other paths of these coins use the Bitcoin version bytes of their purpose.
+var coinExtendedPublicKeyVersions = map[[2]uint32][4]byte{
+	{44, 2}: {0x01, 0x9d, 0xa4, 0x62}, // Ltub
+	{49, 2}: {0x01, 0xb2, 0x6e, 0xf6}, // Mtub
+	{44, 3}: {0x02, 0xfa, 0xca, 0xfd}, // dgub
+}
+
+func (b *backend) exportExtendedPublicKey(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	path := data.Get("path").(string)
+	format := data.Get("format").(string)
+
+	indexes, err := parseDerivationPath(path)
+	if err != nil {
+		return nil, err
+	}
+	// the version bytes follow the purpose and the coin type of the path, the standard BIP-32
+	// bytes are used for paths outside of BIP-44/49/84/86
+	version := extendedPublicKeyVersions[44].mainnet
+	testnet := len(indexes) > 1 && indexes[1] == hdkeychain.HardenedKeyStart+1
+	switch format {
+	case "slip132":
+		if len(indexes) > 0 && indexes[0] >= hdkeychain.HardenedKeyStart {
+			purpose := indexes[0] - hdkeychain.HardenedKeyStart
+			if versions, ok := extendedPublicKeyVersions[purpose]; ok {
+				version = versions.mainnet
+				if testnet {
+					version = versions.testnet
+				}
+			}
+			if len(indexes) > 1 && indexes[1] >= hdkeychain.HardenedKeyStart {
+				if coinVersion, ok := coinExtendedPublicKeyVersions[[2]uint32{purpose, indexes[1] - hdkeychain.HardenedKeyStart}]; ok {
+					version = coinVersion
+				}
+			}
+		}
+	case "bip32":
+		if testnet {
+			version = extendedPublicKeyVersions[44].testnet
+		}
+	default:
+		return nil, fmt.Errorf("Unsupported 'format' value %s, it must be slip132 or bip32", format)
+	}
+
+	wallet, err := b.retrieveWallet(ctx, req, name)
+	if err != nil {
+		return nil, err
+	}
+	if wallet == nil {
+		return nil, fmt.Errorf("Wallet %s does not exist", name)
+	}
+	master, err := wallet.masterKey()
+	if err != nil {
+		return nil, err
+	}
+	defer master.Zero()
+	key, err := wallet.deriveKey(path)
+	if err != nil {
+		return nil, err
+	}
+	defer key.Zero()
+	pub, err := key.Neuter()
+	if err != nil {
+		return nil, err
+	}
+	pub, err = pub.CloneWithVersion(version[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"extendedPublicKey": pub.String(),
+			"derivationPath":    formatDerivationPath(path),
+			"masterFingerprint": masterFingerprint(master),
+		},
+	}, nil
+}
+
+// storeDerivedAccount saves the account of the wallet key at the derivation path. The account
+// only references the wallet and the path, its key is derived again whenever it signs.
+func (b *backend) storeDerivedAccount(ctx context.Context, req *logical.Request, wallet *Wallet, path string, addressType string, hrp string) (*logical.Response, error) {
+	key, err := wallet.deriveKey(path)
+	if err != nil {
+		return nil, err
+	}
+	defer key.Zero()
+	pub, err := key.ECPubKey()
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := newAccount(pub, addressType, hrp, true)
+	if err != nil {
+		b.Logger().Error("Failed to derive the account address", "error", err)
+		return nil, err
+	}
+	account.Wallet = wallet.Name
+	account.DerivationPath = formatDerivationPath(path)
+
+	existing, err := b.retrieveAccountRaw(ctx, req, account.Address)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		if existing.Wallet != account.Wallet {
+			return nil, fmt.Errorf("Account %s already exists", account.Address)
+		}
+	} else {
+		// the wallet lists the account first, so that deleting the wallet never leaves it behind
+		wallet.Accounts = append(wallet.Accounts, account.Address)
+		if err := b.saveWallet(ctx, req, wallet); err != nil {
+			return nil, err
+		}
+		entry, _ := logical.StorageEntryJSON(fmt.Sprintf("accounts/%s", account.Address), account)
+		if err := req.Storage.Put(ctx, entry); err != nil {
+			b.Logger().Error("Failed to save the derived account to storage", "error", err)
+			return nil, err
+		}
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"address":        account.Address,
+			"addressType":    account.AddressType,
+			"derivationPath": account.DerivationPath,
+		},
+	}
+	forms, _ := accountAddressForms(account)
+	for k, v := range forms {
+		resp.Data[k] = v
+	}
+	return resp, nil
+}
+
+// lockWallet locks the wallet for a change of its entry or of its accounts, and returns the
+// function unlocking it
+func (b *backend) lockWallet(name string) func() {
+	lock := locksutil.LockForKey(b.walletLocks, name)
+	lock.Lock()
+	return lock.Unlock
+}
+
+// removeWalletAccount drops a deleted derived account from the list of its wallet
+func (b *backend) removeWalletAccount(ctx context.Context, req *logical.Request, name string, address string) error {
+	defer b.lockWallet(name)()
+	wallet, err := b.retrieveWallet(ctx, req, name)
+	if err != nil || wallet == nil {
+		return err
+	}
+	accounts := []string{}
+	for _, a := range wallet.Accounts {
+		if a != address {
+			accounts = append(accounts, a)
+		}
+	}
+	wallet.Accounts = accounts
+	return b.saveWallet(ctx, req, wallet)
+}
+
+func (b *backend) retrieveWallet(ctx context.Context, req *logical.Request, name string) (*Wallet, error) {
+	path := fmt.Sprintf("wallets/%s", name)
+	entry, err := req.Storage.Get(ctx, path)
+	if err != nil {
+		b.Logger().Error("Failed to retrieve the wallet by name", "path", path, "error", err)
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	var wallet Wallet
+	_ = entry.DecodeJSON(&wallet)
+	return &wallet, nil
+}
+
+func (b *backend) saveWallet(ctx context.Context, req *logical.Request, wallet *Wallet) error {
+	entry, _ := logical.StorageEntryJSON(fmt.Sprintf("wallets/%s", wallet.Name), wallet)
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		b.Logger().Error("Failed to save the wallet to storage", "error", err)
+		return err
+	}
+	return nil
+}
+
+// retrievePrivateKey returns the private key of the account, derived from the wallet seed for
+// accounts derived from a wallet. The key must be zeroed by the caller.
+func (b *backend) retrievePrivateKey(ctx context.Context, req *logical.Request, account *Account) (*ecdsa.PrivateKey, error) {
+	if account.Wallet == "" {
+		privateKey, err := crypto.HexToECDSA(account.PrivateKey)
+		if err != nil {
+			b.Logger().Error("Error reconstructing private key from retrieved hex", "error", err)
+			return nil, fmt.Errorf("Error reconstructing private key from retrieved hex")
+		}
+		return privateKey, nil
+	}
+
+	wallet, err := b.retrieveWallet(ctx, req, account.Wallet)
+	if err != nil {
+		return nil, fmt.Errorf("Error retrieving wallet %s", account.Wallet)
+	}
+	if wallet == nil {
+		return nil, fmt.Errorf("Wallet %s of account %s does not exist", account.Wallet, account.Address)
+	}
+	key, err := wallet.deriveKey(account.DerivationPath)
+	if err != nil {
+		b.Logger().Error("Error deriving private key from the wallet", "error", err)
+		return nil, fmt.Errorf("Error deriving private key from the wallet")
+	}
+	defer key.Zero()
+	btcKey, err := key.ECPrivKey()
+	if err != nil {
+		return nil, err
+	}
+	defer btcKey.Zero()
+	// a wallet created again under the same name has another seed
+	if hex.EncodeToString(btcKey.PubKey().SerializeUncompressed()[1:]) != account.PublicKey {
+		b.Logger().Error("The key derived from the wallet does not match the account", "wallet", account.Wallet, "address", account.Address)
+		return nil, fmt.Errorf("The key derived from wallet %s does not match account %s", account.Wallet, account.Address)
+	}
+	keyBytes := btcKey.Serialize()
+	defer zeroBytes(keyBytes)
+	return crypto.ToECDSA(keyBytes)
+}
+
+// masterKey returns the BIP-32 master key of the wallet, to be zeroed by the caller
+func (w *Wallet) masterKey() (*hdkeychain.ExtendedKey, error) {
+	seed, err := hex.DecodeString(w.Seed)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(seed)
+	// the network only selects the serialization version bytes, not used here
+	return hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+}
+
+// deriveKey returns the private extended key at the BIP-32 path, to be zeroed by the caller
+func (w *Wallet) deriveKey(path string) (*hdkeychain.ExtendedKey, error) {
+	indexes, err := parseDerivationPath(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := w.masterKey()
+	if err != nil {
+		return nil, err
+	}
+	for _, index := range indexes {
+		child, err := key.Derive(index)
+		key.Zero()
+		if err != nil {
+			return nil, err
+		}
+		key = child
+	}
+	return key, nil
+}
+
+// masterFingerprint returns the hex encoded fingerprint of the master key, as used in PSBT
+// derivation paths and extended keys
+func masterFingerprint(master *hdkeychain.ExtendedKey) string {
+	pub, _ := master.ECPubKey()
+	return hex.EncodeToString(btcutil.Hash160(pub.SerializeCompressed())[:4])
+}
+
+// parseDerivationPath parses BIP-32 paths such as m/44'/60'/0'/0/0, hardened indexes are
+// marked with ', h or H
+func parseDerivationPath(path string) ([]uint32, error) {
+	elements := strings.Split(strings.TrimSpace(path), "/")
+	if elements[0] != "m" {
+		return nil, fmt.Errorf("Invalid derivation path %s, it must start with m", path)
+	}
+	indexes := make([]uint32, 0, len(elements)-1)
+	for _, element := range elements[1:] {
+		offset := uint32(0)
+		if trimmed := strings.TrimRight(element, "'hH"); len(trimmed) == len(element)-1 {
+			offset = hdkeychain.HardenedKeyStart
+			element = trimmed
+		}
+		index, err := strconv.ParseUint(element, 10, 32)
+		if err != nil || uint32(index) >= hdkeychain.HardenedKeyStart {
+			return nil, fmt.Errorf("Invalid derivation path %s", path)
+		}
+		indexes = append(indexes, uint32(index)+offset)
+	}
+	return indexes, nil
+}
+
+// formatDerivationPath normalizes the path to use ' for hardened indexes
+func formatDerivationPath(path string) string {
+	indexes, _ := parseDerivationPath(path)
+	var sb strings.Builder
+	sb.WriteString("m")
+	for _, index := range indexes {
+		if index >= hdkeychain.HardenedKeyStart {
+			sb.WriteString(fmt.Sprintf("/%d'", index-hdkeychain.HardenedKeyStart))
+		} else {
+			sb.WriteString(fmt.Sprintf("/%d", index))
+		}
+	}
+	return sb.String()
+}
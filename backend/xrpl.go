@@ -0,0 +1,107 @@
+// Copyright © 2020 Kaleido
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	btcecdsa "github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/base58"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// xrplTxSignPrefix is the hash prefix of single signed transactions, "STX\0"
+var xrplTxSignPrefix = []byte{0x53, 0x54, 0x58, 0x00}
+
+// xrplSigningPubKeyField is the field header of SigningPubKey (type 7, field 3) followed by the
+// length of a compressed secp256k1 key
+var xrplSigningPubKeyField = []byte{0x73, 0x21}
+
+// the XRP Ledger uses the base58 encoding of Bitcoin with its own alphabet
+var xrplAlphabet = strings.NewReplacer(func() []string {
+	const bitcoinAlphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+	const rippleAlphabet = "rpshnaf39wBUDNEGHJKLM4PQRST7VWXYZ2bcdeCg65jkm8oFqi1tuvAxyz"
+	pairs := make([]string, 0, 2*len(bitcoinAlphabet))
+	for i := range bitcoinAlphabet {
+		pairs = append(pairs, bitcoinAlphabet[i:i+1], rippleAlphabet[i:i+1])
+	}
+	return pairs
+}()...)
+
+// xrplAddress encodes the public key as an XRP Ledger classic address, the base58check of the
+// account ID RIPEMD160(SHA256(compressed public key)) with the type prefix 0x00
+func xrplAddress(publicKey *btcec.PublicKey) string {
+	return xrplAlphabet.Replace(base58.CheckEncode(btcutil.Hash160(publicKey.SerializeCompressed()), 0x00))
+}
+
+// sha512Half is the first 256 bits of the SHA-512 hash, used by the XRP Ledger for signing
+func sha512Half(data ...[]byte) []byte {
+	hash := sha512.New()
+	for _, d := range data {
+		hash.Write(d)
+	}
+	return hash.Sum(nil)[:32]
+}
+
+func (b *backend) signXrpl(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	from := data.Get("name").(string)
+
+	sign, err := b.prepareSignXrpl(data)
+	if err != nil {
+		return nil, err
+	}
+	return b.signWithAccount(ctx, req, from, sign)
+}
+
+func (b *backend) prepareSignXrpl(data *framework.FieldData) (signFunc, error) {
+	input := strings.TrimPrefix(strings.TrimSpace(data.Get("transaction").(string)), "0x")
+	tx, err := hex.DecodeString(input)
+	if err != nil || len(tx) == 0 {
+		return nil, fmt.Errorf("Invalid transaction hex, it must be a non-empty hexidecimal string")
+	}
+	// serialized transactions start with a field header, never with the prefix, so a prefixed
+	// input is accepted as is
+	tx = bytes.TrimPrefix(tx, xrplTxSignPrefix)
+	digest := sha512Half(xrplTxSignPrefix, tx)
+
+	return func(account *Account, privateKey *ecdsa.PrivateKey) (map[string]interface{}, error) {
+		key := toBtcecKey(privateKey)
+		defer key.Zero()
+		publicKey := key.PubKey().SerializeCompressed()
+
+		// the ledger rejects a signature that does not verify against the SigningPubKey field
+		if !bytes.Contains(tx, append(append([]byte{}, xrplSigningPubKeyField...), publicKey...)) {
+			return nil, fmt.Errorf("'transaction' must have the SigningPubKey %X of the signing account", publicKey)
+		}
+
+		// RFC 6979 signature with a low S, the canonical form required by the ledger
+		signature := btcecdsa.Sign(key, digest)
+
+		return map[string]interface{}{
+			"signature":     fmt.Sprintf("%X", signature.Serialize()),
+			"signingPubKey": fmt.Sprintf("%X", publicKey),
+			"digest":        fmt.Sprintf("%X", digest),
+		}, nil
+	}, nil
+}
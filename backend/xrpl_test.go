@@ -0,0 +1,113 @@
+package backend
+
+import (
+	"context"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	btcecdsa "github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestXrplAddress(t *testing.T) {
+	assert := assert.New(t)
+
+	// public key and address of the genesis account, whose secret is "masterpassphrase"
+	pub, _ := hex.DecodeString("0330E7FC9D56BB25D6893BA3F317AE5BCF33B3291BD63DB32654A313222F7FD020")
+	publicKey, _ := btcec.ParsePubKey(pub)
+	assert.Equal("rHb9CJAWyB4rj91VRWn96DkukG4bwdtyTh", xrplAddress(publicKey))
+
+	b, storage := getBackend(t)
+
+	res, err := createAccountWithType(t, b, storage, "0000000000000000000000000000000000000000000000000000000000000001", "XRPL")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	assert.Equal("rBgGZ9tc4him9KBzD8fKFiQz3fSZpaSwMH", res.Data["address"].(string))
+
+	// coin 144 derives m/44'/144'/0'/0/index, as Xumm and Ledger do
+	req := logical.TestRequest(t, logical.CreateOperation, "wallets/w1")
+	req.Storage = storage
+	req.Data = map[string]interface{}{
+		"mnemonic": "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+	}
+	if _, err := b.HandleRequest(context.Background(), req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req = logical.TestRequest(t, logical.CreateOperation, "wallets/w1/derive")
+	req.Storage = storage
+	req.Data = map[string]interface{}{
+		"coin": 144,
+	}
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	assert.Equal("m/44'/144'/0'/0/0", res.Data["derivationPath"].(string))
+	assert.Equal("XRPL", res.Data["addressType"].(string))
+	assert.Regexp("^r[1-9A-HJ-NP-Za-km-z]{24,34}$", res.Data["address"].(string))
+}
+
+func TestSignXrpl(t *testing.T) {
+	assert := assert.New(t)
+
+	b, storage := getBackend(t)
+
+	res, err := createAccountWithType(t, b, storage, "ec85999367d32fbbe02dd600a2a44550b95274cc67d14375a9f0bce233f13ad2", "XRPL")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	address := res.Data["address"].(string)
+	privateKey, _ := hex.DecodeString("ec85999367d32fbbe02dd600a2a44550b95274cc67d14375a9f0bce233f13ad2")
+	_, publicKey := btcec.PrivKeyFromBytes(privateKey)
+	signingPubKey := fmt.Sprintf("%X", publicKey.SerializeCompressed())
+
+	// TransactionType, Flags, Sequence, Amount, Fee, SigningPubKey, Account and Destination of a Payment
+	tx := "120000" + "2280000000" + "2400000001" + "61400000000000000A" + "68400000000000000C" +
+		"7321" + signingPubKey +
+		"8114" + strings.Repeat("11", 20) +
+		"8314" + strings.Repeat("22", 20)
+	txBytes, _ := hex.DecodeString(tx)
+	hash := sha512.Sum512(append([]byte("STX\x00"), txBytes...))
+	digest := hash[:32]
+
+	req := logical.TestRequest(t, logical.CreateOperation, "accounts/"+address+"/sign-xrpl")
+	req.Storage = storage
+	for _, input := range []string{tx, strings.ToLower(tx), "53545800" + tx} {
+		req.Data = map[string]interface{}{
+			"transaction": input,
+		}
+		res, err = b.HandleRequest(context.Background(), req)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		assert.Equal(fmt.Sprintf("%X", digest), res.Data["digest"].(string))
+		assert.Equal(signingPubKey, res.Data["signingPubKey"].(string))
+
+		der, _ := hex.DecodeString(res.Data["signature"].(string))
+		signature, err := btcecdsa.ParseDERSignature(der)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		s := signature.S()
+		assert.False(s.IsOverHalfOrder())
+		assert.True(signature.Verify(digest, publicKey))
+	}
+
+	for input, expected := range map[string]string{
+		"":                         "Invalid transaction hex, it must be a non-empty hexidecimal string",
+		"0xzz":                     "Invalid transaction hex, it must be a non-empty hexidecimal string",
+		"120000" + "7300" + "8114": "'transaction' must have the SigningPubKey " + signingPubKey + " of the signing account",
+	} {
+		req.Data = map[string]interface{}{
+			"transaction": input,
+		}
+		_, err = b.HandleRequest(context.Background(), req)
+		assert.Equal(expected, err.Error())
+	}
+}